@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math"
 	"os"
 	"strings"
 
@@ -29,9 +28,15 @@ const (
 	defaultQuantity = 1
 )
 
+// типы инструментов, для которых можно сгенерировать конфиг, и их названия для пользователя
+var (
+	instrumentTypes     = []string{sdk.InstrumentTypeShare, sdk.InstrumentTypeEtf, sdk.InstrumentTypeBond, sdk.InstrumentTypeFuture, sdk.InstrumentTypeCurrency}
+	instrumentTypesInfo = []string{"Акции", "Фонды (ETF)", "Облигации", "Фьючерсы", "Валюты"}
+)
+
 func main() {
 	fmt.Println(color.GreenString("🤖 Генератор конфига для торгового робота запущен!"))
-	fmt.Println("Робот создан для торговли", color.MagentaString("базовыми акциями 📈"), "в Тинькофф Инвестиции")
+	fmt.Println("Робот создан для торговли", color.MagentaString("акциями, фондами, облигациями, фьючерсами и валютами 📈"), "в Тинькофф Инвестиции")
 	fmt.Println("Сгенерировать", color.MagentaString("конфигурации"), "вы можете с помощью инструкций ниже 💫")
 
 	// Инициализация SDK
@@ -49,14 +54,9 @@ func main() {
 	}
 
 	// Формирование информации об аккаунтах
-	// TODO может это привести к общему виду? (isSandbox)
 	isSandbox := utils.RequestBool("⏳ Сконфигурировать робота для работы в Sandbox?", scanner)
-	var accounts []*investapi.Account
-	if isSandbox {
-		accounts, _, err = s.GetSandboxAccounts()
-	} else {
-		accounts, _, err = s.GetAccounts()
-	}
+	broker := sdk.NewBroker(s, isSandbox)
+	accounts, _, err := broker.GetAccounts()
 	if err != nil {
 		log.Fatalf("Не удается получить информацию об аккаунтах: %v", err)
 	}
@@ -87,13 +87,7 @@ func main() {
 		} else {
 			accountInfo += account.GetId()
 		}
-		var portfolio *investapi.PortfolioResponse
-		// TODO может это привести к общему виду? (isSandbox)
-		if isSandbox {
-			portfolio, _, err = s.GetSandboxPortfolio(account.GetId())
-		} else {
-			portfolio, _, err = s.GetPortfolio(account.GetId())
-		}
+		portfolio, _, err := broker.GetPortfolio(account.GetId())
 		if err != nil {
 			log.Fatalf("Не удается получить портфолио аккаунта %s: %v", account.GetId(), err)
 		}
@@ -129,17 +123,25 @@ func main() {
 		other[requiredParameter] = requestInt
 	}
 
+	orderType := config.MarketOrder
+	if utils.RequestBool("🎯 Входить в позицию лимитными заявками вместо рыночных?", scanner) {
+		orderType = config.LimitOrder
+	}
+
 	strategyConfig := config.StrategyConfig{
-		Name:     ruleStrategyName,
-		Interval: interval,
-		Quantity: defaultQuantity,
-		Other:    other,
+		Name:      ruleStrategyName,
+		Interval:  interval,
+		Quantity:  defaultQuantity,
+		OrderType: orderType,
+		Other:     other,
 	}
 
-	// Выбор акций для торговли
-	responseShares, _, err := s.GetShares()
+	// Выбор инструментов для торговли
+	n = utils.RequestChoice("🧺 Выберите тип инструментов", instrumentTypesInfo, scanner)
+	instrumentType := instrumentTypes[n]
+	instruments, err := s.Instruments().GetByType(instrumentType)
 	if err != nil {
-		log.Fatalf("Не удается получить информацию об акциях: %v", err)
+		log.Fatalf("Не удается получить информацию об инструментах: %v", err)
 	}
 
 	// Создание конфигурации для каждого тикера
@@ -148,25 +150,26 @@ func main() {
 		var input string
 		if isTryAgain {
 			isTryAgain = false
-			input = utils.RequestString("🏷 Уточните тикеры акций введенные неверно (через пробел)", scanner)
+			input = utils.RequestString("🏷 Уточните тикеры инструментов введенные неверно (через пробел)", scanner)
 		} else {
-			input = utils.RequestString("🛍 Введите тикеры акций для торговли (через пробел)", scanner)
+			input = utils.RequestString("🛍 Введите тикеры инструментов для торговли (через пробел)", scanner)
 		}
 		inputTickers := strings.Split(input, " ")
 	tickerLoop:
 		for _, inputTicker := range inputTickers {
-			for _, share := range responseShares {
-				if share.GetTicker() == strings.ToUpper(inputTicker) {
+			for _, instrument := range instruments {
+				if instrument.Ticker == strings.ToUpper(inputTicker) {
 					tradingConfig := config.TradingConfig{
 						AccountId:      account.GetId(),
 						IsSandbox:      isSandbox,
-						Ticker:         share.GetTicker(),
-						Figi:           share.GetFigi(),
-						Exchange:       share.GetExchange(),
-						Currency:       share.GetCurrency(),
+						InstrumentType: instrument.InstrumentType,
+						Ticker:         instrument.Ticker,
+						Figi:           instrument.Figi,
+						Exchange:       instrument.Exchange,
+						Currency:       instrument.Currency,
 						StrategyConfig: strategyConfig,
 					}
-					filename := share.GetTicker() + "_" + account.GetId() + ".yaml"
+					filename := instrument.Ticker + "_" + account.GetId() + ".yaml"
 					if err = config.WriteTradingConfig(configsPath, filename, &tradingConfig); err != nil {
 						color.Yellow("Торговая конфигурация %s не была записана %v", filename, err)
 						isTryAgain = true
@@ -187,21 +190,25 @@ func main() {
 }
 
 func portfolioReport(portfolio *investapi.PortfolioResponse) string {
-	totalAmount := sdk.MoneyValueToFloat(portfolio.GetTotalAmountCurrencies()) +
-		sdk.MoneyValueToFloat(portfolio.GetTotalAmountBonds()) +
-		sdk.MoneyValueToFloat(portfolio.GetTotalAmountShares()) +
-		sdk.MoneyValueToFloat(portfolio.GetTotalAmountEtf()) +
-		sdk.MoneyValueToFloat(portfolio.GetTotalAmountFutures())
+	totalAmount := sdk.MoneyValueToDecimal(portfolio.GetTotalAmountCurrencies()).
+		Add(sdk.MoneyValueToDecimal(portfolio.GetTotalAmountBonds())).
+		Add(sdk.MoneyValueToDecimal(portfolio.GetTotalAmountShares())).
+		Add(sdk.MoneyValueToDecimal(portfolio.GetTotalAmountEtf())).
+		Add(sdk.MoneyValueToDecimal(portfolio.GetTotalAmountFutures()))
 
-	report := bold("%.2f₽ ", totalAmount)
+	report := bold("%s₽ ", totalAmount.StringFixed(2))
 	if portfolio.ExpectedYield != nil {
-		expectedYield := sdk.QuotationToFloat(portfolio.ExpectedYield)
+		expectedYield := sdk.QuotationToDecimal(portfolio.ExpectedYield)
 
-		income := fmt.Sprintf("%.2f₽ (%.2f%%)", totalAmount*expectedYield/100, math.Abs(expectedYield))
+		income := fmt.Sprintf(
+			"%s₽ (%s%%)",
+			totalAmount.Mul(expectedYield).DivInt(100).StringFixed(2),
+			expectedYield.Abs().StringFixed(2),
+		)
 		switch {
-		case expectedYield < 0:
+		case expectedYield.Sign() < 0:
 			report += color.RedString(income)
-		case expectedYield > 0:
+		case expectedYield.Sign() > 0:
 			report += color.GreenString(income)
 		default:
 			report += color.WhiteString(income)
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/pkg/archive"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+	"tinkoff-invest-bot/pkg/utils"
+)
+
+var scanner = bufio.NewScanner(os.Stdin)
+
+var instrumentTypes = []string{sdk.InstrumentTypeShare, sdk.InstrumentTypeEtf, sdk.InstrumentTypeBond, sdk.InstrumentTypeFuture, sdk.InstrumentTypeCurrency}
+
+const robotConfigPath = "./configs/robot.yaml"
+
+func main() {
+	fmt.Println(color.GreenString("🤖 Архив исторических свечей для торгового робота запущен!"))
+	fmt.Println("Свечи из архива", color.MagentaString("используются бэктестом и разогревом роботов 🦕"))
+	fmt.Println("Архив хранится в", color.MagentaString(archive.DefaultDir), "и может работать без доступа к API")
+
+	history, err := archive.Open(archive.DefaultDir)
+	if err != nil {
+		log.Fatalf("Не удается открыть архив свечей: %v", err)
+	}
+
+	robotConfig := config.LoadRobotConfig(robotConfigPath)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var s *sdk.SDK
+	if robotConfig.TinkoffAccessToken != "" {
+		s, err = sdk.New(robotConfig.TinkoffApiEndpoint, robotConfig.TinkoffAccessToken, robotConfig.AppName, ctx)
+		if err != nil {
+			log.Fatalf("Не удается инициализировать SDK: %v", err)
+		}
+	}
+
+	actions := []string{"Загрузить свечи из Тинькофф Инвестиции", "Импортировать свечи из CSV файла", "Показать содержимое архива"}
+	switch utils.RequestChoice("🗄 Что сделать?", actions, scanner) {
+	case 0:
+		if s == nil {
+			log.Fatalf("Токен доступа (TINKOFF_ACCESS_TOKEN) не был найден в .env")
+		}
+		download(s, history)
+	case 1:
+		importCSV(s, history)
+	case 2:
+		printArchive(history)
+	}
+}
+
+// download загружает свечи инструмента за выбранный период и сохраняет их в архив
+func download(s *sdk.SDK, history *archive.Archive) {
+	instrument := requestInstrument(s)
+	n := utils.RequestChoice("🕯 Выберите свечной интервал", sdk.Intervals, scanner)
+	interval := sdk.Intervals[n]
+	from, to := requestPeriod()
+
+	fmt.Println("Загрузка свечей, это может занять несколько минут...")
+	candles, err := s.History().GetCandles(instrument.Figi, from, to, sdk.IntervalToCandleInterval(interval))
+	if err != nil {
+		log.Fatalf("Не удается получить свечи: %v", err)
+	}
+	if err = history.Write(instrument, interval, from, to, candles); err != nil {
+		log.Fatalf("Не удается записать свечи в архив: %v", err)
+	}
+	color.Green("В архив записано свечей %s: %d", instrument.Ticker, len(candles))
+}
+
+// importCSV добавляет в архив свечи из стороннего CSV файла в формате архива
+func importCSV(s *sdk.SDK, history *archive.Archive) {
+	path := utils.RequestString("📄 Введите путь к CSV файлу (time,open,high,low,close,volume)", scanner)
+
+	var instrument *sdk.InstrumentInfo
+	if s != nil {
+		instrument = requestInstrument(s)
+	} else {
+		// без доступа к API параметры инструмента нужно ввести вручную, бэктест возьмёт их из архива
+		instrument = &sdk.InstrumentInfo{
+			Figi:   strings.ToUpper(utils.RequestString("🏷 Введите FIGI инструмента", scanner)),
+			Ticker: strings.ToUpper(utils.RequestString("🏷 Введите тикер инструмента", scanner)),
+			Lot:    int64(utils.RequestInt("📦 Введите лотность инструмента", scanner)),
+		}
+		n := utils.RequestChoice("🧺 Выберите тип инструмента", instrumentTypes, scanner)
+		instrument.InstrumentType = instrumentTypes[n]
+		instrument.Currency = strings.ToLower(utils.RequestString("💱 Введите валюту инструмента (например rub)", scanner))
+		for {
+			increment, err := decimal.NewFromString(utils.RequestString("📏 Введите шаг цены инструмента", scanner))
+			if err == nil && increment.Sign() > 0 {
+				instrument.MinPriceIncrement = increment
+				break
+			}
+			color.Yellow("Шаг цены должен быть положительным числом")
+		}
+	}
+	n := utils.RequestChoice("🕯 Выберите свечной интервал файла", sdk.Intervals, scanner)
+	interval := sdk.Intervals[n]
+
+	count, gaps, err := history.Import(instrument, interval, path)
+	if err != nil {
+		log.Fatalf("Не удается импортировать свечи: %v", err)
+	}
+	color.Green("В архив импортировано свечей %s: %d", instrument.Ticker, count)
+	for _, gap := range gaps {
+		color.Yellow("Нет свечей с %s по %s, этот промежуток не отмечен в архиве", gap.From.Format("02-01-06 15:04"), gap.To.Format("02-01-06 15:04"))
+	}
+}
+
+func printArchive(history *archive.Archive) {
+	entries := history.Entries()
+	if len(entries) == 0 {
+		color.Yellow("Архив пуст")
+		return
+	}
+	for _, e := range entries {
+		fmt.Printf("%s (%s) %s: %s — %s\n", e.Ticker, e.Figi, e.Interval, e.From.Format("02-01-06 15:04"), e.To.Format("02-01-06 15:04"))
+	}
+}
+
+// requestInstrument запрашивает у пользователя тикер или FIGI и находит инструмент в справочнике
+func requestInstrument(s *sdk.SDK) *sdk.InstrumentInfo {
+	for {
+		input := strings.ToUpper(utils.RequestString("🏷 Введите тикер или FIGI инструмента", scanner))
+		if instrument, err := s.Instruments().GetByFigi(input); err == nil {
+			return instrument
+		}
+		instruments, err := s.Instruments().GetByTicker(input)
+		if err != nil {
+			log.Fatalf("Не удается получить информацию об инструментах: %v", err)
+		}
+		switch len(instruments) {
+		case 0:
+			color.Yellow("Инструмент \"%s\" не найден!", input)
+		case 1:
+			return instruments[0]
+		default:
+			var instrumentsInfo []string
+			for _, instrument := range instruments {
+				instrumentsInfo = append(instrumentsInfo, fmt.Sprintf("%s %s (%s)", instrument.Figi, instrument.Name, instrument.Exchange))
+			}
+			n := utils.RequestChoice("🧺 Найдено несколько инструментов, выберите нужный", instrumentsInfo, scanner)
+			return instruments[n]
+		}
+	}
+}
+
+func requestPeriod() (from time.Time, to time.Time) {
+	for {
+		from = utils.RequestDate("🎬 Введите дату начала в формате DD-MM-YY", scanner)
+		to = utils.RequestDate("🎬 Введите дату конца в формате DD-MM-YY", scanner)
+		if from.Before(to) {
+			return from, to
+		}
+		color.Yellow("Дата начала должна быть раньше даты конца")
+	}
+}
@@ -5,12 +5,18 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 
 	"tinkoff-invest-bot/internal/config"
 	"tinkoff-invest-bot/internal/engine"
+	"tinkoff-invest-bot/pkg/archive"
 	"tinkoff-invest-bot/pkg/graphics"
 	"tinkoff-invest-bot/pkg/sdk"
 )
@@ -41,39 +47,114 @@ func main() {
 		fmt.Printf("%v\n", conf)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// SDK живёт дольше роботов: при остановке роботам ещё нужно отписаться и отменить заявки
+	sdkCtx, cancelSdk := context.WithCancel(context.Background())
+	defer cancelSdk()
 
-	s, err := sdk.New(robotConfig.TinkoffApiEndpoint, robotConfig.TinkoffAccessToken, robotConfig.AppName, ctx)
+	s, err := sdk.New(robotConfig.TinkoffApiEndpoint, robotConfig.TinkoffAccessToken, robotConfig.AppName, sdkCtx)
 	if err != nil {
 		logger.Fatal("Can't init SDK", zap.Error(err))
 	}
+	s.SetLogger(logger)
+	var streamEvents sdk.StreamEventsConsumer = streamEventsLogger{logger: logger}
+	s.AddStreamEventsConsumer(&streamEvents)
 	s.Run()
 
-	go serveGraphics(8080, logger)
+	history, err := archive.Open(archive.DefaultDir) // архив свечей для разогрева стратегий
+	if err != nil {
+		logger.Fatal("Can't open candles archive", zap.Error(err))
+	}
+
+	server := serveGraphics(8080, logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	var wg sync.WaitGroup
+	var failed int32
 	for _, conf := range tradingConfigs {
-		wg.Add(1)
-		robotInstance, err := engine.New(robotConfig, conf, s, logger)
+		robotInstance, err := engine.New(robotConfig, conf, s, history, logger)
 		if err != nil {
 			logger.Fatal("Cant create robot instance", zap.Error(err))
 		}
-		go func() {
-			robotInstance.Run()
-			wg.Done()
-		}()
+		wg.Add(1)
+		go func(ticker string) {
+			defer wg.Done()
+			if err := robotInstance.Run(ctx); err != nil {
+				atomic.StoreInt32(&failed, 1)
+				logger.Error("Micro-robot stopped with error", zap.String("ticker", ticker), zap.Error(err))
+			}
+		}(conf.Ticker)
 	}
-	wg.Wait()
+
+	<-ctx.Done()
+	stop() // повторный сигнал завершит процесс сразу
+	logger.Info("Shutdown signal received, stopping micro-robots")
+
+	exitCode := 0
+	if !waitTimeout(&wg, time.Duration(robotConfig.ShutdownTimeout)*time.Second) {
+		logger.Error("Micro-robots didn't stop in time", zap.Int("shutdownTimeout", robotConfig.ShutdownTimeout))
+		exitCode = 1
+	}
+	if atomic.LoadInt32(&failed) == 1 {
+		exitCode = 1
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Can't stop http server", zap.Error(err))
+	}
+	cancelSdk()
+
+	logger.Info("Robot stopped", zap.Int("exitCode", exitCode))
+	_ = logger.Sync()
+	os.Exit(exitCode)
 }
 
-func serveGraphics(port int, logger *zap.Logger) {
-	for {
-		http.Handle("/", graphics.NewGraphHandler(logger))
+// serveGraphics запускает вэб-сервер с графиками в отдельной горутине
+func serveGraphics(port int, logger *zap.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/", graphics.NewGraphHandler(logger))
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+
+	go func() {
 		fmt.Printf("http server listen http://localhost:%d/\n", port)
-		err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
-		if err != nil {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Error("Error in http server", zap.Error(err))
 		}
+	}()
+	return server
+}
+
+// waitTimeout ждёт wg не дольше timeout, false если время вышло
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
 	}
 }
+
+// streamEventsLogger логирует обрывы и восстановления стрима рыночных данных
+type streamEventsLogger struct {
+	logger *zap.Logger
+}
+
+func (l streamEventsLogger) StreamDisconnected(err error) {
+	l.logger.Error("Market data stream disconnected, reconnecting", zap.Error(err))
+}
+
+func (l streamEventsLogger) StreamReconnected() {
+	l.logger.Info("Market data stream reconnected, subscriptions restored")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fatih/color"
+
+	"tinkoff-invest-bot/internal/backtest"
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/pkg/archive"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// loadBatch загружает свечи для каждого конфига. Конфиги, для которых свечей нет, пропускаются с предупреждением
+func loadBatch(
+	s *sdk.SDK,
+	history *archive.Archive,
+	tradingConfigs []*config.TradingConfig,
+	from time.Time,
+	to time.Time,
+) []backtest.BatchJob {
+	var jobs []backtest.BatchJob
+	for _, tradingConfig := range tradingConfigs {
+		candles, instrument, err := fetchHistory(s, history, tradingConfig, from, to)
+		if err != nil {
+			warn("%s_%s пропущен: %v", tradingConfig.Ticker, tradingConfig.AccountId, err)
+			continue
+		}
+		jobs = append(jobs, backtest.BatchJob{TradingConfig: tradingConfig, Instrument: instrument, Candles: candles})
+	}
+	if len(jobs) == 0 {
+		log.Fatalf("Ни для одной стратегии не удалось загрузить свечи")
+	}
+	return jobs
+}
+
+// printBatch выводит конфиги от лучшего к худшему и стоимость общего счёта каждого аккаунта
+func printBatch(results []backtest.BatchResult, accounts []backtest.AccountEquity) {
+	fmt.Println(bold("Стратегии от лучшей к худшей"))
+	for i, r := range results {
+		name := fmt.Sprintf("%s: %s_%s", r.TradingConfig.StrategyConfig.Name, r.TradingConfig.Ticker, r.TradingConfig.AccountId)
+		if r.Err != nil {
+			fmt.Printf("%d. %s: %s\n", i+1, name, color.RedString("%v", r.Err))
+			continue
+		}
+		m := r.Metrics
+		fmt.Printf(
+			"%d. %s %v: %.4f, доходность %s (к покупке и удержанию %s), просадка %.2f%%, Шарп %.2f, сделок %d, доход %s %s\n",
+			i+1, name, r.TradingConfig.StrategyConfig.Other, r.Score, colorizePercent(m.TotalReturn),
+			colorizePercent(r.Result.Comparison().ExcessReturn), m.MaxDrawdown*100, m.Sharpe, m.Trades,
+			colorizeDecimal(r.Result.PnL), r.TradingConfig.Currency,
+		)
+	}
+
+	fmt.Println(bold("Счета (стратегии аккаунта торгуют с общего счёта)"))
+	for _, a := range accounts {
+		if len(a.Equity) == 0 {
+			continue
+		}
+		last := a.Equity[len(a.Equity)-1].Value
+		fmt.Printf(
+			"%s (%s), стратегий %d: %s → %s, доходность %s, просадка %.2f%%, Шарп %.2f, доход по сделкам %s, "+
+				"пропущено покупок из-за нехватки денег %d\n",
+			a.AccountId, a.Currency, a.Configs, a.InitialCapital.StringFixed(2), last.StringFixed(2),
+			colorizePercent(a.Metrics.TotalReturn), a.Metrics.MaxDrawdown*100, a.Metrics.Sharpe, colorizeDecimal(a.PnL),
+			a.SkippedBuys,
+		)
+	}
+}
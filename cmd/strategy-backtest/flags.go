@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"tinkoff-invest-bot/internal/backtest"
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/pkg/archive"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+const (
+	dateLayout        = "2006-01-02"
+	defaultPeriod     = 30 * 24 * time.Hour
+	defaultReportsDir = "./reports/"
+)
+
+// Флаги для запуска бэктеста без вопросов, например из cron
+var (
+	configFlag       = flag.String("config", "", "путь к трейдинг конфигу, без него и -all бэктест запускается в интерактивном режиме")
+	allFlag          = flag.Bool("all", false, "протестировать все конфиги из ./configs/generated/ и сравнить их")
+	rankFlag         = flag.String("rank", rankNames[0], fmt.Sprintf("показатель для сравнения конфигов с -all: %v", rankNames))
+	fromFlag         = flag.String("from", "", "начало периода в формате YYYY-MM-DD, по умолчанию 30 дней до конца периода")
+	toFlag           = flag.String("to", "", "конец периода в формате YYYY-MM-DD, не включительно, по умолчанию сейчас")
+	intervalFlag     = flag.String("interval", "", "свечной интервал вместо интервала из конфига: 1_MIN или 5_MIN")
+	formatFlag       = flag.String("format", "text", "формат результата: text, json или csv")
+	outputFlag       = flag.String("output", "", "файл для json (по умолчанию stdout) или директория для csv (по умолчанию ./reports/)")
+	fillFlag         = flag.String("fill", "next-open", "цена исполнения заявок: next-open или close")
+	slippageFlag     = flag.String("slippage", "0", "проскальзывание")
+	slippageTypeFlag = flag.String("slippage-type", "percent", "в чём задано проскальзывание: percent или ticks")
+	commissionFlag   = flag.String("commission", backtest.CommissionTariffsRate[0].String(), "комиссия брокера в процентах от объёма сделки")
+	capitalFlag      = flag.String("capital", "100000", "начальный капитал в валюте инструмента, с -all и размер общего счёта каждого аккаунта")
+)
+
+// rankNames названия показателей backtest.Objectives для флага -rank
+var rankNames = []string{"return", "sharpe", "sortino", "profit-factor", "return-drawdown"}
+
+// runFromFlags прогоняет бэктест конфига из флагов и выводит результат в выбранном формате
+func runFromFlags(s *sdk.SDK, history *archive.Archive, logger *zap.Logger) {
+	if *formatFlag != "text" && *formatFlag != "json" && *formatFlag != "csv" {
+		log.Fatalf("Неизвестный формат %s, есть только text, json и csv", *formatFlag)
+	}
+	if *intervalFlag != "" && !isKnownInterval(*intervalFlag) {
+		log.Fatalf("Интервал %s не поддерживается, есть только %v", *intervalFlag, sdk.Intervals)
+	}
+	from, to := periodFromFlags()
+	model := fillModelFromFlags()
+	capital := parseDecimal("capital", *capitalFlag)
+	if *allFlag {
+		runBatchFromFlags(s, history, from, to, model, capital, logger)
+		return
+	}
+
+	tradingConfig := config.LoadTradingsConfig(*configFlag)
+	if *intervalFlag != "" {
+		tradingConfig.StrategyConfig.Interval = *intervalFlag
+	}
+	candles, instrument := loadHistory(s, history, tradingConfig, from, to)
+	if *formatFlag == "text" {
+		runBacktest(tradingConfig, instrument, candles, model, capital, logger)
+		return
+	}
+
+	result, err := backtest.Run(tradingConfig, instrument, candles, model, capital, logger)
+	if err != nil {
+		log.Fatalf("Не удается инициализировать стратегию: %v", err)
+	}
+	report := backtest.NewReport(tradingConfig, from, to, result)
+
+	switch *formatFlag {
+	case "json":
+		err = writeJSONOutput(report.WriteJSON)
+	case "csv":
+		err = report.WriteCSV(outputDir(), tradingConfig.Ticker+"_"+tradingConfig.AccountId)
+	}
+	if err != nil {
+		log.Fatalf("Не удается записать результат: %v", err)
+	}
+}
+
+// runBatchFromFlags прогоняет бэктест всех конфигов и выводит сравнение в выбранном формате
+func runBatchFromFlags(
+	s *sdk.SDK,
+	history *archive.Archive,
+	from time.Time,
+	to time.Time,
+	model backtest.FillModel,
+	capital decimal.Decimal,
+	logger *zap.Logger,
+) {
+	objective := -1
+	for i, name := range rankNames {
+		if name == *rankFlag {
+			objective = i
+		}
+	}
+	if objective < 0 {
+		log.Fatalf("Неизвестный показатель %s, есть только %v", *rankFlag, rankNames)
+	}
+
+	tradingConfigs := config.LoadTradingConfigsFromDir(configsPath)
+	if len(tradingConfigs) == 0 {
+		log.Fatalf("Стратегий в %s не было найдено, попробуйте сгенерировать новые", configsPath)
+	}
+	if *intervalFlag != "" {
+		for _, tradingConfig := range tradingConfigs {
+			tradingConfig.StrategyConfig.Interval = *intervalFlag
+		}
+	}
+	jobs := loadBatch(s, history, tradingConfigs, from, to)
+	results := backtest.RunBatch(jobs, model, capital, backtest.Objectives[objective], logger)
+	accounts := backtest.RunAccounts(jobs, model, capital, logger)
+	if *formatFlag == "text" {
+		printBatch(results, accounts)
+		return
+	}
+
+	report := backtest.NewBatchReport(from, to, results, accounts)
+	var err error
+	switch *formatFlag {
+	case "json":
+		err = writeJSONOutput(report.WriteJSON)
+	case "csv":
+		err = report.WriteCSV(outputDir())
+	}
+	if err != nil {
+		log.Fatalf("Не удается записать результат: %v", err)
+	}
+}
+
+// writeJSONOutput записывает JSON в файл из -output или в stdout
+func writeJSONOutput(write func(w io.Writer) error) error {
+	if *outputFlag == "" {
+		return write(os.Stdout)
+	}
+	out, err := os.Create(*outputFlag)
+	if err != nil {
+		return err
+	}
+	if err = write(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// outputDir директория для CSV из -output или defaultReportsDir
+func outputDir() string {
+	if *outputFlag == "" {
+		return defaultReportsDir
+	}
+	return *outputFlag
+}
+
+func periodFromFlags() (time.Time, time.Time) {
+	to := time.Now()
+	if *toFlag != "" {
+		to = parseDate("to", *toFlag)
+	}
+	from := to.Add(-defaultPeriod)
+	if *fromFlag != "" {
+		from = parseDate("from", *fromFlag)
+	}
+	if !from.Before(to) {
+		log.Fatalf("Начало периода %s должно быть раньше конца %s", from.Format(dateLayout), to.Format(dateLayout))
+	}
+	return from, to
+}
+
+func fillModelFromFlags() backtest.FillModel {
+	model := backtest.FillModel{
+		Slippage:          parseDecimal("slippage", *slippageFlag),
+		CommissionPercent: parseDecimal("commission", *commissionFlag),
+	}
+	switch *fillFlag {
+	case "next-open":
+		model.Price = backtest.FillOnNextOpen
+	case "close":
+		model.Price = backtest.FillOnClose
+	default:
+		log.Fatalf("Неизвестная цена исполнения %s, есть только next-open и close", *fillFlag)
+	}
+	switch *slippageTypeFlag {
+	case "percent":
+		model.SlippageType = backtest.SlippagePercent
+	case "ticks":
+		model.SlippageType = backtest.SlippageTicks
+	default:
+		log.Fatalf("Неизвестный тип проскальзывания %s, есть только percent и ticks", *slippageTypeFlag)
+	}
+	return model
+}
+
+func isKnownInterval(interval string) bool {
+	for _, known := range sdk.Intervals {
+		if interval == known {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDate(name string, value string) time.Time {
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		log.Fatalf("Флаг -%s должен быть датой в формате YYYY-MM-DD: %v", name, err)
+	}
+	return t
+}
+
+func parseDecimal(name string, value string) decimal.Decimal {
+	d, err := decimal.NewFromString(value)
+	if err != nil || d.Sign() < 0 {
+		log.Fatalf("Флаг -%s должен быть неотрицательным числом, получено %q", name, value)
+	}
+	return d
+}
@@ -3,29 +3,43 @@ package main
 import (
 	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/iamjinlei/go-tachart/tachart"
 	"go.uber.org/zap"
 
+	"tinkoff-invest-bot/internal/backtest"
 	"tinkoff-invest-bot/internal/config"
-	"tinkoff-invest-bot/internal/strategy"
+	"tinkoff-invest-bot/internal/rule-strategy"
 	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/archive"
+	"tinkoff-invest-bot/pkg/decimal"
 	"tinkoff-invest-bot/pkg/sdk"
 	"tinkoff-invest-bot/pkg/utils"
 )
 
 const (
-	configsPath     = "./configs/generated/"
-	graphsPath      = "./graphs/"
-	robotConfigPath = "./configs/robot.yaml"
+	configsPath          = "./configs/generated/"
+	optimizedConfigsPath = "./configs/optimized/"
+	optimizerTopSize     = 10 // сколько лучших сочетаний параметров показать
+	graphsPath           = "./graphs/"
+	robotConfigPath      = "./configs/robot.yaml"
+)
+
+var (
+	scanner = bufio.NewScanner(os.Stdin)
+	bold    = color.New(color.Bold).SprintfFunc()
 )
 
 func main() {
-	scanner := bufio.NewScanner(os.Stdin)
+	flag.Parse()
+	interactive := *configFlag == "" && !*allFlag // без конфига в флагах бэктест задаёт вопросы, как раньше
+
 	err := config.CreateDirIfNotExist("./logs")
 	if err != nil {
 		log.Fatalf("Cant create dir: %v", err)
@@ -34,22 +48,35 @@ func main() {
 	if err != nil {
 		log.Fatalf("Cant create production logger: %v", err)
 	}
-	fmt.Println(color.GreenString("🤖 Бэктестинг ассистент для торгового робота запущен!"))
-	fmt.Println("Вы можете протестировать", color.MagentaString("сгенерированную стратегию 💫"))
-	fmt.Println("На", color.MagentaString("исторических данных 🦕"), "доступных в Тинькофф Инвестиции")
+	if interactive {
+		fmt.Println(color.GreenString("🤖 Бэктестинг ассистент для торгового робота запущен!"))
+		fmt.Println("Вы можете протестировать", color.MagentaString("сгенерированную стратегию 💫"))
+		fmt.Println("На", color.MagentaString("исторических данных 🦕"), "доступных в Тинькофф Инвестиции")
+	}
 
-	// Инициализация SDK
-	robotConfig := config.LoadRobotConfig(robotConfigPath)
-	if robotConfig.TinkoffAccessToken == "" {
-		log.Fatalf("Токен доступа (TINKOFF_ACCESS_TOKEN) не был найден в .env")
+	history, err := archive.Open(archive.DefaultDir)
+	if err != nil {
+		log.Fatalf("Не удается открыть архив свечей: %v", err)
 	}
 
+	// Инициализация SDK. Без токена бэктест работает только по архиву свечей
+	robotConfig := config.LoadRobotConfig(robotConfigPath)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	s, err := sdk.New(robotConfig.TinkoffApiEndpoint, robotConfig.TinkoffAccessToken, robotConfig.AppName, ctx)
-	if err != nil {
-		log.Fatalf("Не удается инициализировать SDK: %v", err)
+	var s *sdk.SDK
+	if robotConfig.TinkoffAccessToken != "" {
+		s, err = sdk.New(robotConfig.TinkoffApiEndpoint, robotConfig.TinkoffAccessToken, robotConfig.AppName, ctx)
+		if err != nil {
+			log.Fatalf("Не удается инициализировать SDK: %v", err)
+		}
+	} else {
+		warn("Токен доступа (TINKOFF_ACCESS_TOKEN) не найден, свечи будут браться только из архива %s", archive.DefaultDir)
+	}
+
+	if !interactive {
+		runFromFlags(s, history, logger)
+		return
 	}
 
 	// Предложение с выбором конфига
@@ -63,22 +90,24 @@ func main() {
 	if len(tradingConfigs) == 0 {
 		log.Fatalf("Стратегий в %s не было найдено, попробуйте сгенерировать новые", configsPath)
 	}
+	tradingConfigsInfo = append(tradingConfigsInfo, "Все стратегии")
 	n := utils.RequestChoice("📈 Выберите стратегию для тестирования", tradingConfigsInfo, scanner)
-	tradingConfig := tradingConfigs[n]
+	all := n == len(tradingConfigs) // пакетный бэктест всех конфигов
+	var tradingConfig *config.TradingConfig
+	if !all {
+		tradingConfig = tradingConfigs[n]
+	}
 
-	vars := []string{"За последние сутки", "За последнюю неделю", "За последний месяц", "Свой промежуток (не больше месяца)"}
-	vals := []time.Duration{1, 7, 30, 0}
+	vars := []string{"За последние сутки", "За последнюю неделю", "За последний месяц", "За последний год", "Свой промежуток"}
+	vals := []time.Duration{1, 7, 30, 365, 0}
 	n = utils.RequestChoice("🕰 На каком отрезке протестировать стратегию?", vars, scanner)
 	var from, to time.Time
-	var candles []*investapi.HistoricCandle
 	if vals[n] == 0 {
 		for {
 			from = utils.RequestDate("🎬 Введите дату начала в формате DD-MM-YY", scanner)
 			to = utils.RequestDate("🎬 Введите дату конца в формате DD-MM-YY", scanner)
 			if from.After(to) {
 				color.Yellow("Дата начала позже даты конца")
-			} else if to.Sub(from) > time.Hour*24*31 {
-				color.Yellow("Промежуток должен быть не больше месяца")
 			} else {
 				break
 			}
@@ -87,61 +116,313 @@ func main() {
 		to = time.Now()
 		from = to.Add(-time.Hour * 24 * vals[n])
 	}
-	for from.Before(to) {
-		c, _, err := s.GetCandles(
-			tradingConfig.Figi,
-			from,
-			from.AddDate(0, 0, 1).Add(-time.Minute),
-			sdk.IntervalToCandleInterval(tradingConfig.StrategyConfig.Interval),
-		)
+	if all {
+		jobs := loadBatch(s, history, tradingConfigs, from, to)
+		model := requestFillModel()
+		capital := utils.RequestDecimal("💰 Введите начальный капитал счёта в валюте инструментов", scanner)
+		results := backtest.RunBatch(jobs, model, capital, requestObjective(), logger)
+		printBatch(results, backtest.RunAccounts(jobs, model, capital, logger))
+		return
+	}
+	candles, instrument := loadHistory(s, history, tradingConfig, from, to)
+
+	modes := []string{"Протестировать стратегию", "Подобрать параметры стратегии", "Walk-forward анализ параметров"}
+	mode := utils.RequestChoice("🧪 Что сделать?", modes, scanner)
+	model := requestFillModel()
+	capital := utils.RequestDecimal(fmt.Sprintf("💰 Введите начальный капитал, %s", tradingConfig.Currency), scanner)
+	switch mode {
+	case 0:
+		runBacktest(tradingConfig, instrument, candles, model, capital, logger)
+	case 1:
+		runOptimizer(tradingConfig, instrument, candles, model, capital, logger)
+	case 2:
+		runWalkForward(tradingConfig, instrument, candles, model, capital, logger)
+	}
+}
+
+// loadHistory загружает свечи и параметры инструмента и завершает программу, если их нет
+func loadHistory(
+	s *sdk.SDK,
+	history *archive.Archive,
+	tradingConfig *config.TradingConfig,
+	from time.Time,
+	to time.Time,
+) ([]*investapi.HistoricCandle, *sdk.InstrumentInfo) {
+	candles, instrument, err := fetchHistory(s, history, tradingConfig, from, to)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	return candles, instrument
+}
+
+// fetchHistory загружает свечи и параметры инструмента: из архива, если в нём есть весь период,
+// иначе через API, а без доступа к API из той части периода, которая есть в архиве
+func fetchHistory(
+	s *sdk.SDK,
+	history *archive.Archive,
+	tradingConfig *config.TradingConfig,
+	from time.Time,
+	to time.Time,
+) ([]*investapi.HistoricCandle, *sdk.InstrumentInfo, error) {
+	var candles []*investapi.HistoricCandle
+	var err error
+	interval := tradingConfig.StrategyConfig.Interval
+	switch {
+	case history.Covers(tradingConfig.Figi, interval, from, to):
+		candles, err = history.Candles(tradingConfig.Figi, interval, from, to)
+	case s != nil:
+		// история скачивается параллельно по отрезкам и кэшируется на диске, повторный бэктест берёт свечи из кэша
+		candles, err = s.History().GetCandles(tradingConfig.Figi, from, to, sdk.IntervalToCandleInterval(interval))
+	default:
+		warn("В архиве есть не все свечи %s за этот период, загрузить их можно командой history", tradingConfig.Ticker)
+		candles, err = history.Candles(tradingConfig.Figi, interval, from, to)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Не удается получить свечи %s: %v", tradingConfig.Ticker, err)
+	}
+
+	var instrument *sdk.InstrumentInfo
+	if s != nil {
+		instrument, err = s.Instruments().GetByFigi(tradingConfig.Figi)
 		if err != nil {
-			log.Fatalf("Не удается получить свечи: %v", err)
+			return nil, nil, fmt.Errorf("Не удается получить информацию об инструменте %s: %v", tradingConfig.Ticker, err)
+		}
+	} else {
+		var ok bool
+		if instrument, ok = history.Instrument(tradingConfig.Figi); !ok {
+			return nil, nil, fmt.Errorf("В архиве нет свечей %s, загрузите их командой history", tradingConfig.Ticker)
 		}
-		candles = append(candles, c...)
-		from = from.AddDate(0, 0, 1)
 	}
+	if len(candles) == 0 {
+		return nil, nil, fmt.Errorf("За указанный период не было ни одной свечи %s", tradingConfig.Ticker)
+	}
+	return candles, instrument, nil
+}
 
-	strategyWrapper, err := strategy.FromConfig(tradingConfig, s, logger)
+// warn печатает предупреждение в stderr, чтобы не смешивать его с результатом в stdout
+func warn(format string, a ...interface{}) {
+	fmt.Fprintln(os.Stderr, color.YellowString(format, a...))
+}
+
+// runBacktest прогоняет стратегию с параметрами из конфига, выводит сделки и показатели и рисует график
+func runBacktest(
+	tradingConfig *config.TradingConfig,
+	instrument *sdk.InstrumentInfo,
+	candles []*investapi.HistoricCandle,
+	model backtest.FillModel,
+	capital decimal.Decimal,
+	logger *zap.Logger,
+) {
+	result, err := backtest.Run(tradingConfig, instrument, candles, model, capital, logger)
 	if err != nil {
 		log.Fatalf("Не удается инициализировать стратегию: %v", err)
 	}
-	if len(candles) == 0 {
-		log.Fatalf("За указанный период не было ни одной свечи")
-	}
-	for _, candle := range candles {
-		newCandle := strategy.HistoricCandleToTechanCandle(candle, sdk.IntervalToDuration(tradingConfig.StrategyConfig.Interval))
-		op := strategyWrapper.Step(newCandle, false)
-		switch op {
-		case strategy.Buy:
-			strategyWrapper.AddEvent(strategy.Buy, "uid", sdk.QuotationToFloat(candle.Close), sdk.QuotationToFloat(candle.Close))
-		case strategy.Sell:
-			strategyWrapper.AddEvent(strategy.Sell, "uid", sdk.QuotationToFloat(candle.Close), sdk.QuotationToFloat(candle.Close))
-		case strategy.Hold:
-			continue
-		default:
-			panic("Значение не определено")
-		}
-	}
 
-	income := 0.0
-	for i, trade := range strategyWrapper.TradingRecord.Trades {
-		res := trade.ExitOrder().Price.Sub(trade.EntranceOrder().Price).Float()
-		fmt.Printf("Поручение %v. %s\n", i+1, colorizeFloat(res))
-		income += res
+	// доход считается по точным ценам в деньгах, в истории трейдинга techan цены хранятся приближённо
+	for i, trade := range result.Trades {
+		fmt.Printf(
+			"Сделка %v. %s → %s, лотов %d: %s\n",
+			i+1, trade.EntryPrice, trade.ExitPrice, trade.Lots, colorizeDecimal(trade.PnL),
+		)
 	}
-	fmt.Println("Суммарный доход:", colorizeFloat(income), tradingConfig.Currency)
+	if open := result.OpenTrade; open != nil {
+		fmt.Printf("Открытая позиция. %s → %s, лотов %d: %s\n", open.EntryPrice, open.ExitPrice, open.Lots, colorizeDecimal(open.PnL))
+	}
+	fmt.Println("Комиссия брокера:", result.Commission.StringFixed(2), tradingConfig.Currency)
+	fmt.Println("Суммарный доход:", colorizeDecimal(result.PnL), tradingConfig.Currency)
+	printMetrics(result.Metrics(), tradingConfig.Currency)
+	printComparison(result.Benchmark, result.Comparison())
+
 	path := tradingConfig.Ticker + "_" + tradingConfig.AccountId + ".html"
-	strategyWrapper.GenGraph(graphsPath, path)
+	result.Processor.GenGraph(graphsPath, path, tachart.NewLine2(
+		"Стоимость счёта", result.EquityCurve(),
+		"Купить и держать", result.Benchmark.EquityCurve(),
+	))
 	p, _ := os.Getwd()
 	fmt.Printf("График успешно сгенерирован, посмотреть его можно тут: file://%s", p+"/graphs/"+path+"\n")
 }
 
-func colorizeFloat(f float64) string {
+// runOptimizer перебирает параметры стратегии в заданных пользователем промежутках
+// и записывает конфиг с лучшими параметрами в optimizedConfigsPath
+func runOptimizer(
+	tradingConfig *config.TradingConfig,
+	instrument *sdk.InstrumentInfo,
+	candles []*investapi.HistoricCandle,
+	model backtest.FillModel,
+	capital decimal.Decimal,
+	logger *zap.Logger,
+) {
+	ranges := requestRanges(tradingConfig.StrategyConfig.Name)
+	objective := requestObjective()
+
+	fmt.Println("Подбор параметров, это может занять несколько минут...")
+	results, err := backtest.Optimize(tradingConfig, instrument, candles, model, capital, ranges, objective, logger)
+	if err != nil {
+		log.Fatalf("Не удается подобрать параметры: %v", err)
+	}
+	if len(results) == 0 {
+		log.Fatalf("Нет ни одного подходящего сочетания параметров")
+	}
+
+	fmt.Println(bold("Лучшие параметры (%s)", objective.Title))
+	for i, result := range results {
+		if i == optimizerTopSize {
+			break
+		}
+		fmt.Printf(
+			"%d. %v: %s %.4f, доходность %s, просадка %.2f%%, сделок %d, доход %s %s\n",
+			i+1, result.Other, objective.Title, result.Score, colorizePercent(result.Metrics.TotalReturn),
+			result.Metrics.MaxDrawdown*100, result.Metrics.Trades, colorizeDecimal(result.PnL), tradingConfig.Currency,
+		)
+	}
+
+	best := *tradingConfig
+	best.StrategyConfig.Other = results[0].Other
+	filename := tradingConfig.Ticker + "_" + tradingConfig.AccountId + ".yaml"
+	if err = config.WriteTradingConfig(optimizedConfigsPath, filename, &best); err != nil {
+		log.Fatalf("Торговая конфигурация %s не была записана: %v", filename, err)
+	}
+	color.Green("Конфигурация с лучшими параметрами записана в %s", optimizedConfigsPath+filename)
+	fmt.Println("Чтобы робот торговал с ними, перенесите её в", configsPath)
+}
+
+func printMetrics(m backtest.Metrics, currency string) {
+	fmt.Println(bold("Показатели стратегии"))
+	fmt.Printf("Доходность: %s, в пересчёте на год: %s\n", colorizePercent(m.TotalReturn), colorizePercent(m.AnnualizedReturn))
+	fmt.Printf("Максимальная просадка: %.2f%%\n", m.MaxDrawdown*100)
+	fmt.Printf("Коэффициент Шарпа: %.2f, Сортино: %.2f\n", m.Sharpe, m.Sortino)
+	fmt.Printf("Сделок: %d, прибыльных: %.2f%%, профит-фактор: %.2f\n", m.Trades, m.WinRate*100, m.ProfitFactor)
+	fmt.Println("Средний доход сделки:", colorizeDecimal(m.AverageTrade), currency)
+	fmt.Printf("Время в позиции: %.2f%%\n", m.Exposure*100)
+}
+
+// printComparison выводит сравнение стратегии с покупкой и удержанием инструмента
+func printComparison(benchmark *backtest.Benchmark, c backtest.Comparison) {
+	fmt.Println(bold("Сравнение с покупкой и удержанием"))
+	if benchmark.Lots == 0 {
+		warn("Начального капитала не хватает на покупку одного лота")
+	}
+	fmt.Printf(
+		"Лотов %d по %s: доходность %s, в пересчёте на год %s, просадка %.2f%%\n",
+		benchmark.Lots, benchmark.EntryPrice, colorizePercent(c.Benchmark.TotalReturn),
+		colorizePercent(c.Benchmark.AnnualizedReturn), c.Benchmark.MaxDrawdown*100,
+	)
+	fmt.Printf("Избыточная доходность стратегии: %s\n", colorizePercent(c.ExcessReturn))
+	fmt.Printf("Бета: %.2f, корреляция: %.2f\n", c.Beta, c.Correlation)
+}
+
+// runWalkForward подбирает параметры на скользящем окне и проверяет их на следующем за ним отрезке
+func runWalkForward(
+	tradingConfig *config.TradingConfig,
+	instrument *sdk.InstrumentInfo,
+	candles []*investapi.HistoricCandle,
+	model backtest.FillModel,
+	capital decimal.Decimal,
+	logger *zap.Logger,
+) {
+	ranges := requestRanges(tradingConfig.StrategyConfig.Name)
+	objective := requestObjective()
+	inSample := utils.RequestInt("🔬 Сколько дней подбирать параметры в каждом окне?", scanner)
+	outOfSample := utils.RequestInt("🔭 Сколько дней проверять подобранные параметры?", scanner)
+
+	fmt.Println("Walk-forward анализ, это может занять несколько минут...")
+	result, err := backtest.WalkForward(
+		tradingConfig, instrument, candles, model, capital, ranges, objective,
+		time.Duration(inSample)*24*time.Hour, time.Duration(outOfSample)*24*time.Hour, logger,
+	)
+	if err != nil {
+		log.Fatalf("Не удается провести walk-forward анализ: %v", err)
+	}
+
+	fmt.Println(bold("Окна (%s на подборе → на проверке)", objective.Title))
+	for i, window := range result.Windows {
+		fmt.Printf(
+			"%d. %s — %s: %v, %.4f → %.4f, доходность на проверке %s, доход %s %s\n",
+			i+1, window.OutOfSampleFrom.Format("02.01.06"), window.OutOfSampleTo.Format("02.01.06"), window.Other,
+			window.InSampleScore, window.OutOfSampleScore, colorizePercent(window.OutOfSample.TotalReturn),
+			colorizeDecimal(window.OutOfSamplePnL), tradingConfig.Currency,
+		)
+	}
+	fmt.Println(bold("Стабильность параметров"))
+	for _, s := range result.Stability {
+		fmt.Printf("%s: от %d до %d, среднее %.1f, отклонение %.1f\n", s.Name, s.Min, s.Max, s.Mean, s.StdDev)
+	}
+	fmt.Printf("Эффективность (годовая доходность на проверке к доходности на подборе): %.2f\n", result.Efficiency)
+	printMetrics(result.Metrics, tradingConfig.Currency)
+}
+
+// requestRanges запрашивает промежутки перебора для каждого параметра стратегии
+func requestRanges(strategyName string) []backtest.ParameterRange {
+	var ranges []backtest.ParameterRange
+	for _, name := range rule_strategy.RequiredParameters[strategyName] {
+		for {
+			r := backtest.ParameterRange{
+				Name: name,
+				From: utils.RequestInt(fmt.Sprintf("📏 Минимальное значение \"%s\"", name), scanner),
+				To:   utils.RequestInt(fmt.Sprintf("📏 Максимальное значение \"%s\"", name), scanner),
+				Step: utils.RequestInt(fmt.Sprintf("📏 Шаг перебора \"%s\"", name), scanner),
+			}
+			if r.From > 0 && r.From <= r.To && r.Step > 0 {
+				ranges = append(ranges, r)
+				break
+			}
+			color.Yellow("Значения должны быть положительными, а минимальное не больше максимального")
+		}
+	}
+	return ranges
+}
+
+func requestObjective() backtest.Objective {
+	var objectivesInfo []string
+	for _, objective := range backtest.Objectives {
+		objectivesInfo = append(objectivesInfo, objective.Title)
+	}
+	return backtest.Objectives[utils.RequestChoice("🏆 По какому показателю выбирать лучшие параметры?", objectivesInfo, scanner)]
+}
+
+// requestFillModel запрашивает у пользователя, как исполнять заявки в бэктесте
+func requestFillModel() backtest.FillModel {
+	model := backtest.DefaultFillModel
+
+	prices := []string{"По открытию следующей свечи", "По закрытию свечи с сигналом"}
+	if utils.RequestChoice("💸 По какой цене исполнять заявки?", prices, scanner) == 1 {
+		model.Price = backtest.FillOnClose
+	}
+
+	slippageTypes := []string{"В процентах от цены", "В шагах цены инструмента"}
+	if utils.RequestChoice("🎢 Как задать проскальзывание?", slippageTypes, scanner) == 1 {
+		model.SlippageType = backtest.SlippageTicks
+	}
+	model.Slippage = utils.RequestDecimal("🎢 Введите проскальзывание (0 без проскальзывания)", scanner)
+
+	tariffs := append(append([]string(nil), backtest.CommissionTariffs...), "Своя комиссия")
+	n := utils.RequestChoice("🧾 Выберите тариф брокера", tariffs, scanner)
+	if n < len(backtest.CommissionTariffsRate) {
+		model.CommissionPercent = backtest.CommissionTariffsRate[n]
+	} else {
+		model.CommissionPercent = utils.RequestDecimal("🧾 Введите комиссию в процентах от объёма сделки", scanner)
+	}
+	return model
+}
+
+// colorizePercent доля в процентах, окрашенная по знаку
+func colorizePercent(f float64) string {
+	s := fmt.Sprintf("%.2f%%", f*100)
 	if f < 0 {
-		return color.RedString("%f", f)
+		return color.RedString("%s", s)
 	} else if f > 0 {
-		return color.GreenString("%f", f)
+		return color.GreenString("%s", s)
+	}
+	return color.WhiteString("%s", s)
+}
+
+// colorizeDecimal денежная сумма с точностью до копеек, окрашенная по знаку
+func colorizeDecimal(d decimal.Decimal) string {
+	if d.Sign() < 0 {
+		return color.RedString("%s", d.StringFixed(2))
+	} else if d.Sign() > 0 {
+		return color.GreenString("%s", d.StringFixed(2))
 	} else {
-		return color.WhiteString("%f", f)
+		return color.WhiteString("%s", d.StringFixed(2))
 	}
 }
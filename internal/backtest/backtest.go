@@ -0,0 +1,107 @@
+package backtest
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/internal/strategy"
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// backtestOrderId идентификатор заявок бэктеста в истории трейдинга
+const backtestOrderId = "backtest"
+
+// Trade сделка бэктеста: вход в позицию и выход из неё
+type Trade struct {
+	EntryTime  time.Time
+	ExitTime   time.Time // время последней свечи, если позиция не закрыта
+	EntryPrice decimal.Decimal
+	ExitPrice  decimal.Decimal // цена закрытия последней свечи, если позиция не закрыта
+	Lots       int64
+	Commission decimal.Decimal // комиссия за вход и выход
+	PnL        decimal.Decimal // доход в деньгах за вычетом комиссии
+}
+
+// Result результат бэктеста, доходы и комиссии указаны в валюте инструмента
+type Result struct {
+	Processor  *strategy.CandlesStrategyProcessor // стратегия с историей трейдинга и свечами для графика
+	Instrument *sdk.InstrumentInfo
+	Trades     []Trade // закрытые сделки
+	OpenTrade  *Trade  // позиция, не закрытая к концу периода, оценённая по последней цене
+	Commission decimal.Decimal
+	PnL        decimal.Decimal // доход по закрытым сделкам за вычетом комиссии
+
+	InitialCapital decimal.Decimal
+	Equity         []EquityPoint // начальный капитал и стоимость счёта на закрытии каждой свечи
+	Benchmark      *Benchmark    // покупка и удержание инструмента на тех же свечах
+}
+
+// Metrics показатели эффективности стратегии
+func (r *Result) Metrics() Metrics {
+	return ComputeMetrics(r.Processor.TradingRecord, r.Trades, r.Equity)
+}
+
+// Comparison сравнение стратегии с покупкой и удержанием инструмента
+func (r *Result) Comparison() Comparison {
+	return Compare(r.Equity, r.Benchmark.Equity)
+}
+
+// EquityCurve стоимость счёта на закрытии каждой свечи для графика, по точке на свечу графика стратегии
+func (r *Result) EquityCurve() []float64 {
+	if len(r.Equity) == 0 {
+		return nil
+	}
+	curve := make([]float64, len(r.Equity)-1)
+	for i, point := range r.Equity[1:] {
+		curve[i] = point.Value.Float()
+	}
+	return curve
+}
+
+// Run прогоняет стратегию из трейдинг конфига по закрытым свечам. Сигнал вычисляется на закрытии свечи,
+// заявка исполняется по модели исполнения model на количество лотов из конфига.
+// Стоимость счёта считается от начального капитала capital, денег на счёте может стать меньше нуля
+func Run(
+	tradingConfig *config.TradingConfig,
+	instrument *sdk.InstrumentInfo,
+	candles []*investapi.HistoricCandle,
+	model FillModel,
+	capital decimal.Decimal,
+	logger *zap.Logger,
+) (*Result, error) {
+	return run(tradingConfig, instrument, nil, candles, model, capital, logger)
+}
+
+// run прогоняет стратегию по candles, перед этим разогревая индикаторы свечами warmUp без торговли
+func run(
+	tradingConfig *config.TradingConfig,
+	instrument *sdk.InstrumentInfo,
+	warmUp []*investapi.HistoricCandle,
+	candles []*investapi.HistoricCandle,
+	model FillModel,
+	capital decimal.Decimal,
+	logger *zap.Logger,
+) (*Result, error) {
+	t, err := newTrader(tradingConfig, instrument, warmUp, model, capital, logger)
+	if err != nil {
+		return nil, err
+	}
+	cash := capital
+	for _, candle := range candles {
+		if !candle.GetIsComplete() { // незакрытая свеча ещё изменится, в торговле по ней сигнал бы не считался
+			continue
+		}
+		if len(t.result.Equity) == 0 {
+			t.result.Equity = append(t.result.Equity, EquityPoint{Time: candle.GetTime().AsTime(), Value: capital})
+		}
+		t.step(candle, &cash, false)
+		t.result.Equity = append(t.result.Equity, EquityPoint{Time: t.closeTime(candle), Value: cash.Add(t.positionValue())})
+	}
+	t.finish()
+	t.result.Benchmark = BuyAndHold(instrument, candles, model, capital, t.period)
+	return t.result, nil
+}
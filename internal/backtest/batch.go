@@ -0,0 +1,178 @@
+package backtest
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// BatchJob трейдинг конфиг со свечами и параметрами инструмента для пакетного бэктеста
+type BatchJob struct {
+	TradingConfig *config.TradingConfig
+	Instrument    *sdk.InstrumentInfo
+	Candles       []*investapi.HistoricCandle
+}
+
+// BatchResult результат бэктеста одного конфига из пакета
+type BatchResult struct {
+	TradingConfig *config.TradingConfig
+	Result        *Result
+	Metrics       Metrics
+	Score         float64 // значение показателя, по которому ранжируются конфиги
+	Err           error   // ошибка бэктеста этого конфига, остальные конфиги тестируются независимо от неё
+}
+
+// AccountEquity стоимость счёта аккаунта, на котором все его конфиги одной валюты торгуют с общего кошелька
+type AccountEquity struct {
+	AccountId      string
+	Currency       string
+	Configs        int
+	InitialCapital decimal.Decimal // размер счёта, общий для всех конфигов
+	PnL            decimal.Decimal // доход по закрытым сделкам всех конфигов за вычетом комиссии
+	SkippedBuys    int             // покупки, не исполненные из-за нехватки денег на счёте, сигналы подряд считаются за одну
+	Equity         []EquityPoint
+	Metrics        Metrics // показатели по стоимости счёта, время в позиции не считается
+}
+
+// RunBatch параллельно прогоняет бэктест каждого конфига из jobs с капиталом capital
+// и возвращает результаты, отсортированные по objective от лучшего к худшему. Конфиги с ошибкой идут в конце
+func RunBatch(jobs []BatchJob, model FillModel, capital decimal.Decimal, objective Objective, logger *zap.Logger) []BatchResult {
+	results := make([]BatchResult, len(jobs))
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				job := jobs[idx]
+				results[idx].TradingConfig = job.TradingConfig
+				result, err := Run(job.TradingConfig, job.Instrument, job.Candles, model, capital, logger)
+				if err != nil {
+					results[idx].Err = err
+					continue
+				}
+				results[idx].Result = result
+				results[idx].Metrics = result.Metrics()
+				results[idx].Score = objective.Value(results[idx].Metrics)
+			}
+		}()
+	}
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Err != nil || results[j].Err != nil {
+			return results[j].Err != nil && results[i].Err == nil
+		}
+		return better(results[i].Score, results[j].Score)
+	})
+	return results
+}
+
+// RunAccounts прогоняет конфиги каждого аккаунта и валюты вместе на одном счёте с капиталом capital.
+// Свечи всех конфигов обрабатываются по времени их закрытия, покупка, на которую на счёте не хватает денег,
+// пропускается. Конфиги, стратегию которых не удалось создать, в счёт не входят, их ошибку возвращает RunBatch
+func RunAccounts(jobs []BatchJob, model FillModel, capital decimal.Decimal, logger *zap.Logger) []AccountEquity {
+	type key struct{ accountId, currency string }
+	var keys []key
+	grouped := make(map[key][]BatchJob)
+	for _, job := range jobs {
+		k := key{job.TradingConfig.AccountId, job.TradingConfig.Currency}
+		if _, ok := grouped[k]; !ok {
+			keys = append(keys, k)
+		}
+		grouped[k] = append(grouped[k], job)
+	}
+
+	accounts := make([]AccountEquity, len(keys))
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Add(1)
+		go func(i int, k key) {
+			defer wg.Done()
+			accounts[i] = runAccount(grouped[k], model, capital, logger)
+			accounts[i].AccountId, accounts[i].Currency = k.accountId, k.currency
+		}(i, k)
+	}
+	wg.Wait()
+
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return accounts[i].AccountId < accounts[j].AccountId
+	})
+	return accounts
+}
+
+// accountCandle закрытая свеча конфига с индексом trader в прогоне счёта
+type accountCandle struct {
+	trader int
+	candle *investapi.HistoricCandle
+	close  time.Time
+}
+
+// runAccount прогоняет конфиги jobs с общего счёта с капиталом capital
+func runAccount(jobs []BatchJob, model FillModel, capital decimal.Decimal, logger *zap.Logger) AccountEquity {
+	account := AccountEquity{InitialCapital: capital}
+	var traders []*trader
+	var candles []accountCandle
+	for _, job := range jobs {
+		t, err := newTrader(job.TradingConfig, job.Instrument, nil, model, capital, logger)
+		if err != nil {
+			continue
+		}
+		for _, candle := range job.Candles {
+			if candle.GetIsComplete() {
+				candles = append(candles, accountCandle{trader: len(traders), candle: candle, close: t.closeTime(candle)})
+			}
+		}
+		traders = append(traders, t)
+	}
+	account.Configs = len(traders)
+	if len(candles) == 0 {
+		return account
+	}
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].close.Before(candles[j].close)
+	})
+
+	cash := capital
+	start := candles[0].candle.GetTime().AsTime()
+	for _, c := range candles[1:] {
+		if t := c.candle.GetTime().AsTime(); t.Before(start) {
+			start = t
+		}
+	}
+	account.Equity = append(account.Equity, EquityPoint{Time: start, Value: capital})
+	for i, c := range candles {
+		traders[c.trader].step(c.candle, &cash, true)
+		if i+1 < len(candles) && candles[i+1].close.Equal(c.close) {
+			continue // стоимость счёта считается, когда закрылись свечи всех конфигов на этот момент
+		}
+		value := cash
+		for _, t := range traders {
+			value = value.Add(t.positionValue())
+		}
+		account.Equity = append(account.Equity, EquityPoint{Time: c.close, Value: value})
+	}
+
+	var trades []Trade
+	for _, t := range traders {
+		t.finish()
+		account.PnL = account.PnL.Add(t.result.PnL)
+		account.SkippedBuys += t.skippedBuys
+		trades = append(trades, t.result.Trades...)
+	}
+	account.Metrics = ComputeMetrics(nil, trades, account.Equity)
+	return account
+}
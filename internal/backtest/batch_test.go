@@ -0,0 +1,151 @@
+package backtest
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+var batchStart = time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC)
+
+// batchJob конфиг doubleEMA 2/3 на один лот из 10 бумаг. На свечах batchPrices он покупает
+// по открытию свечи 10:07 за 99 и продаёт по открытию свечи 10:12 за 100, доход 10
+func batchJob(accountId string, figi string, strategyName string) BatchJob {
+	return BatchJob{
+		TradingConfig: &config.TradingConfig{
+			AccountId:      accountId,
+			Figi:           figi,
+			Currency:       "rub",
+			InstrumentType: sdk.InstrumentTypeShare,
+			StrategyConfig: config.StrategyConfig{
+				Name:     strategyName,
+				Interval: "1_MIN",
+				Quantity: 1,
+				Other:    map[string]int{"short_window": 2, "long_window": 3},
+			},
+		},
+		Instrument: &sdk.InstrumentInfo{Figi: figi, InstrumentType: sdk.InstrumentTypeShare, Lot: 10, MinPriceIncrement: decimal.RequireFromString("0.01")},
+		Candles:    minuteCandles(batchStart, batchPrices()...),
+	}
+}
+
+// batchPrices цены свечей, каждая из которых открывается по закрытию предыдущей
+func batchPrices() [][2]string {
+	closes := []string{"100", "99", "98", "97", "96", "97", "99", "102", "104", "105", "103", "100", "97", "95", "94"}
+	prices := make([][2]string, len(closes))
+	for i, c := range closes {
+		prices[i] = [2]string{c, c}
+		if i > 0 {
+			prices[i][0] = closes[i-1]
+		}
+	}
+	return prices
+}
+
+func TestRunAccounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		capital     int64
+		jobs        []BatchJob
+		configs     int
+		pnl         string
+		skippedBuys int
+		afterBuy    string // стоимость счёта на закрытии свечи 10:07, первой свечи в позиции
+		last        string
+	}{
+		{
+			name:    "one config",
+			capital: 1500,
+			jobs:    []BatchJob{batchJob("acc", "FIGI1", "doubleEMA")},
+			configs: 1, pnl: "10", afterBuy: "1530", last: "1510",
+		},
+		{
+			// лот стоит 990, денег хватает на обе покупки, в позиции 20 бумаг по 102
+			name:    "enough cash for both configs",
+			capital: 2000,
+			jobs:    []BatchJob{batchJob("acc", "FIGI1", "doubleEMA"), batchJob("acc", "FIGI2", "doubleEMA")},
+			configs: 2, pnl: "20", afterBuy: "2060", last: "2020",
+		},
+		{
+			// после первой покупки на счёте 510, вторая покупка пропускается
+			name:    "cash for one config",
+			capital: 1500,
+			jobs:    []BatchJob{batchJob("acc", "FIGI1", "doubleEMA"), batchJob("acc", "FIGI2", "doubleEMA")},
+			configs: 2, pnl: "10", skippedBuys: 1, afterBuy: "1530", last: "1510",
+		},
+		{
+			name:    "config without strategy is excluded",
+			capital: 1500,
+			jobs:    []BatchJob{batchJob("acc", "FIGI1", "doubleEMA"), batchJob("acc", "FIGI2", "unknown")},
+			configs: 1, pnl: "10", afterBuy: "1530", last: "1510",
+		},
+	}
+	for _, tt := range tests {
+		accounts := RunAccounts(tt.jobs, FillModel{}, decimal.NewFromInt(tt.capital), zap.NewNop())
+		if len(accounts) != 1 {
+			t.Errorf("%s: %d accounts, want 1", tt.name, len(accounts))
+			continue
+		}
+		a := accounts[0]
+		if a.Configs != tt.configs || a.PnL.String() != tt.pnl || a.SkippedBuys != tt.skippedBuys || !a.InitialCapital.Equal(decimal.NewFromInt(tt.capital)) {
+			t.Errorf("%s: configs %d, pnl %s, skipped %d, capital %s, want %d, %s, %d, %d",
+				tt.name, a.Configs, a.PnL, a.SkippedBuys, a.InitialCapital, tt.configs, tt.pnl, tt.skippedBuys, tt.capital)
+		}
+		// начальная точка и по точке на закрытие каждой минуты, свечи разных конфигов закрываются одновременно
+		if len(a.Equity) != len(batchPrices())+1 {
+			t.Errorf("%s: %d equity points, want %d", tt.name, len(a.Equity), len(batchPrices())+1)
+			continue
+		}
+		first, afterBuy, last := a.Equity[0], a.Equity[8], a.Equity[len(a.Equity)-1]
+		if !first.Time.Equal(batchStart) || first.Value.String() != strconv.FormatInt(tt.capital, 10) {
+			t.Errorf("%s: equity starts with %s at %s", tt.name, first.Value, first.Time)
+		}
+		if !afterBuy.Time.Equal(batchStart.Add(8*time.Minute)) || afterBuy.Value.String() != tt.afterBuy {
+			t.Errorf("%s: equity after buy %s at %s, want %s", tt.name, afterBuy.Value, afterBuy.Time, tt.afterBuy)
+		}
+		if last.Value.String() != tt.last {
+			t.Errorf("%s: equity ends with %s, want %s", tt.name, last.Value, tt.last)
+		}
+	}
+}
+
+func TestRunAccountsGroupsByAccountAndCurrency(t *testing.T) {
+	usd := batchJob("acc", "FIGI3", "doubleEMA")
+	usd.TradingConfig.Currency = "usd"
+	jobs := []BatchJob{batchJob("b", "FIGI1", "doubleEMA"), batchJob("a", "FIGI2", "doubleEMA"), usd, batchJob("b", "FIGI4", "doubleEMA")}
+
+	want := []struct {
+		accountId, currency string
+		configs             int
+	}{
+		{accountId: "a", currency: "rub", configs: 1},
+		{accountId: "acc", currency: "usd", configs: 1},
+		{accountId: "b", currency: "rub", configs: 2},
+	}
+	accounts := RunAccounts(jobs, FillModel{}, decimal.NewFromInt(5000), zap.NewNop())
+	if len(accounts) != len(want) {
+		t.Fatalf("%d accounts, want %d", len(accounts), len(want))
+	}
+	for i, w := range want {
+		if a := accounts[i]; a.AccountId != w.accountId || a.Currency != w.currency || a.Configs != w.configs {
+			t.Errorf("account %d is %s %s with %d configs, want %s %s with %d", i, a.AccountId, a.Currency, a.Configs, w.accountId, w.currency, w.configs)
+		}
+	}
+}
+
+func TestRunBatchPutsErrorsLast(t *testing.T) {
+	jobs := []BatchJob{batchJob("acc", "FIGI1", "unknown"), batchJob("acc", "FIGI2", "doubleEMA")}
+	results := RunBatch(jobs, FillModel{}, decimal.NewFromInt(1500), Objectives[0], zap.NewNop())
+	if results[0].Err != nil || results[0].Result.PnL.String() != "10" || !almostEqual(results[0].Score, 10.0/1500) {
+		t.Errorf("first result: err %v, score %v, want the doubleEMA config with return 10/1500", results[0].Err, results[0].Score)
+	}
+	if results[1].Err == nil || results[1].TradingConfig.Figi != "FIGI1" {
+		t.Errorf("last result: %s with err %v, want FIGI1 with an error", results[1].TradingConfig.Figi, results[1].Err)
+	}
+}
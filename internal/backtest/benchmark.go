@@ -0,0 +1,120 @@
+package backtest
+
+import (
+	"math"
+	"time"
+
+	"tinkoff-invest-bot/internal/strategy"
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// Benchmark покупка и удержание инструмента стратегии на тех же свечах и с тем же капиталом
+type Benchmark struct {
+	Lots       int64           // купленные лоты, 0 если капитала не хватило и на один лот
+	EntryPrice decimal.Decimal // цена покупки с учётом проскальзывания
+	Commission decimal.Decimal
+	Equity     []EquityPoint // в те же моменты времени, что и стоимость счёта стратегии
+}
+
+// Comparison сравнение стратегии с покупкой и удержанием по доходности и доходностям на каждой свече
+type Comparison struct {
+	Benchmark    Metrics // показатели покупки и удержания, сделок и времени в позиции в них нет
+	ExcessReturn float64 // доходность стратегии за период минус доходность покупки и удержания
+	Beta         float64 // бета стратегии к покупке и удержанию, NaN если цена не менялась
+	Correlation  float64 // корреляция доходностей стратегии и покупки и удержания, NaN если её нельзя посчитать
+}
+
+// BuyAndHold покупает на весь капитал целое количество лотов на первой закрытой свече по той же цене,
+// что и стратегия: по закрытию свечи для FillOnClose, иначе по её открытию. Лоты держатся до конца,
+// позиция оценивается по цене закрытия каждой свечи
+func BuyAndHold(
+	instrument *sdk.InstrumentInfo,
+	candles []*investapi.HistoricCandle,
+	model FillModel,
+	capital decimal.Decimal,
+	period time.Duration,
+) *Benchmark {
+	candles = completeCandles(candles)
+	benchmark := &Benchmark{}
+	if len(candles) == 0 {
+		return benchmark
+	}
+
+	reference := sdk.QuotationToDecimal(candles[0].GetOpen())
+	if model.Price == FillOnClose {
+		reference = sdk.QuotationToDecimal(candles[0].GetClose())
+	}
+	benchmark.EntryPrice = model.ExecutionPrice(strategy.Buy, reference, instrument)
+	lotPrice := instrument.LotPrice(benchmark.EntryPrice)
+	lotCost := lotPrice.Add(model.Commission(lotPrice))
+	if lotCost.Sign() > 0 {
+		benchmark.Lots = capital.Div(lotCost).FloorToStep(decimal.NewFromInt(1)).Units()
+	}
+	units := instrument.LotsToUnits(benchmark.Lots)
+	benchmark.Commission = model.Commission(benchmark.EntryPrice.MulInt(units))
+	cash := capital.Sub(benchmark.EntryPrice.MulInt(units)).Sub(benchmark.Commission)
+
+	benchmark.Equity = make([]EquityPoint, 0, len(candles)+1)
+	benchmark.Equity = append(benchmark.Equity, EquityPoint{Time: candles[0].GetTime().AsTime(), Value: capital})
+	for _, candle := range candles {
+		value := cash.Add(sdk.QuotationToDecimal(candle.GetClose()).MulInt(units))
+		benchmark.Equity = append(benchmark.Equity, EquityPoint{Time: candle.GetTime().AsTime().Add(period), Value: value})
+	}
+	return benchmark
+}
+
+// EquityCurve стоимость счёта покупки и удержания на закрытии каждой свечи, как Result.EquityCurve
+func (b *Benchmark) EquityCurve() []float64 {
+	if len(b.Equity) == 0 {
+		return nil
+	}
+	curve := make([]float64, len(b.Equity)-1)
+	for i, point := range b.Equity[1:] {
+		curve[i] = point.Value.Float()
+	}
+	return curve
+}
+
+// Compare сравнивает кривую стоимости счёта стратегии с кривой покупки и удержания, точки кривых сопоставляются по порядку
+func Compare(equity []EquityPoint, benchmark []EquityPoint) Comparison {
+	c := Comparison{Benchmark: ComputeMetrics(nil, nil, benchmark), Beta: math.NaN(), Correlation: math.NaN()}
+	c.ExcessReturn = ComputeMetrics(nil, nil, equity).TotalReturn - c.Benchmark.TotalReturn
+
+	var returns, benchmarkReturns []float64
+	for i := 1; i < len(equity) && i < len(benchmark); i++ {
+		prev, benchmarkPrev := equity[i-1].Value.Float(), benchmark[i-1].Value.Float()
+		if prev <= 0 || benchmarkPrev <= 0 {
+			continue
+		}
+		returns = append(returns, equity[i].Value.Float()/prev-1)
+		benchmarkReturns = append(benchmarkReturns, benchmark[i].Value.Float()/benchmarkPrev-1)
+	}
+	if len(returns) < 2 {
+		return c
+	}
+
+	mean, benchmarkMean := average(returns), average(benchmarkReturns)
+	var covariance, variance, benchmarkVariance float64
+	for i := range returns {
+		covariance += (returns[i] - mean) * (benchmarkReturns[i] - benchmarkMean)
+		variance += (returns[i] - mean) * (returns[i] - mean)
+		benchmarkVariance += (benchmarkReturns[i] - benchmarkMean) * (benchmarkReturns[i] - benchmarkMean)
+	}
+	if benchmarkVariance > 0 {
+		c.Beta = covariance / benchmarkVariance
+		if variance > 0 {
+			c.Correlation = covariance / math.Sqrt(variance*benchmarkVariance)
+		}
+	}
+	return c
+}
+
+func average(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,141 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// minuteCandles закрытые минутные свечи подряд с ценами открытия и закрытия из prices
+func minuteCandles(start time.Time, prices ...[2]string) []*investapi.HistoricCandle {
+	candles := make([]*investapi.HistoricCandle, len(prices))
+	for i, p := range prices {
+		open, closePrice := decimal.RequireFromString(p[0]), decimal.RequireFromString(p[1])
+		high, low := open, closePrice
+		if closePrice.GreaterThan(open) {
+			high, low = closePrice, open
+		}
+		candles[i] = &investapi.HistoricCandle{
+			Time:       timestamppb.New(start.Add(time.Duration(i) * time.Minute)),
+			Open:       sdk.DecimalToQuotation(open),
+			High:       sdk.DecimalToQuotation(high),
+			Low:        sdk.DecimalToQuotation(low),
+			Close:      sdk.DecimalToQuotation(closePrice),
+			Volume:     1,
+			IsComplete: true,
+		}
+	}
+	return candles
+}
+
+func TestBuyAndHold(t *testing.T) {
+	start := time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC)
+	instrument := &sdk.InstrumentInfo{Lot: 10, MinPriceIncrement: decimal.RequireFromString("0.01")}
+	candles := minuteCandles(start, [2]string{"100", "101"}, [2]string{"101", "105"}, [2]string{"105", "99"})
+	forming := minuteCandles(start.Add(3*time.Minute), [2]string{"99", "200"})[0]
+	forming.IsComplete = false
+
+	tests := []struct {
+		name       string
+		model      FillModel
+		lots       int64
+		entry      string
+		commission string
+		equity     []string
+	}{
+		{
+			// лот стоит 1000, на 5000 покупается 5 лотов без сдачи
+			name:  "next open",
+			model: FillModel{Price: FillOnNextOpen},
+			lots:  5, entry: "100", commission: "0",
+			equity: []string{"5000", "5050", "5250", "4950"},
+		},
+		{
+			// лот стоит 1010, 4 лота и 960 на счёте
+			name:  "close",
+			model: FillModel{Price: FillOnClose},
+			lots:  4, entry: "101", commission: "0",
+			equity: []string{"5000", "5000", "5160", "4920"},
+		},
+		{
+			// лот с комиссией 0.3% стоит 1003, 4 лота с комиссией 12 и 988 на счёте
+			name:  "commission",
+			model: FillModel{Price: FillOnNextOpen, CommissionPercent: decimal.RequireFromString("0.3")},
+			lots:  4, entry: "100", commission: "12",
+			equity: []string{"5000", "5028", "5188", "4948"},
+		},
+		{
+			// полшага проскальзывания, покупка по 100.005 округляется вверх до 100.01, 4 лота и 999.6 на счёте
+			name:  "slippage",
+			model: FillModel{Price: FillOnNextOpen, SlippageType: SlippageTicks, Slippage: decimal.RequireFromString("0.5")},
+			lots:  4, entry: "100.01", commission: "0",
+			equity: []string{"5000", "5039.6", "5199.6", "4959.6"},
+		},
+	}
+	for _, tt := range tests {
+		b := BuyAndHold(instrument, append(candles, forming), tt.model, decimal.NewFromInt(5000), time.Minute)
+		if b.Lots != tt.lots || b.EntryPrice.String() != tt.entry || b.Commission.String() != tt.commission {
+			t.Errorf("%s: %d lots at %s with commission %s, want %d at %s with %s",
+				tt.name, b.Lots, b.EntryPrice, b.Commission, tt.lots, tt.entry, tt.commission)
+		}
+		if len(b.Equity) != len(tt.equity) {
+			t.Errorf("%s: %d equity points, want %d", tt.name, len(b.Equity), len(tt.equity))
+			continue
+		}
+		for i, want := range tt.equity {
+			wantTime := start.Add(time.Duration(i) * time.Minute) // начальная точка на открытии первой свечи, затем закрытия свечей
+			if b.Equity[i].Value.String() != want || !b.Equity[i].Time.Equal(wantTime) {
+				t.Errorf("%s: equity point %d is %s at %s, want %s at %s", tt.name, i, b.Equity[i].Value, b.Equity[i].Time, want, wantTime)
+			}
+		}
+	}
+}
+
+func TestBuyAndHoldNotEnoughCapital(t *testing.T) {
+	instrument := &sdk.InstrumentInfo{Lot: 10, MinPriceIncrement: decimal.RequireFromString("0.01")}
+	candles := minuteCandles(time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC), [2]string{"100", "110"})
+	b := BuyAndHold(instrument, candles, FillModel{}, decimal.NewFromInt(999), time.Minute)
+	if b.Lots != 0 || b.EquityCurve()[0] != 999 {
+		t.Errorf("%d lots, equity %v, want no lots and unchanged capital", b.Lots, b.EquityCurve())
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name                      string
+		equity, benchmark         []EquityPoint
+		excess, beta, correlation float64
+	}{
+		{
+			// доходности стратегии 0.05, -0.019047619, 0.048543689, покупки и удержания 0.02, -0.009803922, 0.02970297
+			name:      "strategy moves with the market",
+			equity:    equityCurve("100", "105", "103", "108"),
+			benchmark: equityCurve("100", "102", "101", "104"),
+			excess:    0.04, beta: 1.853590894203123, correlation: 0.9673242296779259,
+		},
+		{
+			name:      "strategy is the market",
+			equity:    equityCurve("100", "110", "99"),
+			benchmark: equityCurve("100", "110", "99"),
+			excess:    0, beta: 1, correlation: 1,
+		},
+		{
+			name:      "strategy against the market",
+			equity:    equityCurve("100", "90", "99"),
+			benchmark: equityCurve("100", "110", "99"),
+			excess:    0, beta: -1, correlation: -1,
+		},
+	}
+	for _, tt := range tests {
+		c := Compare(tt.equity, tt.benchmark)
+		if !almostEqual(c.ExcessReturn, tt.excess) || !almostEqual(c.Beta, tt.beta) || !almostEqual(c.Correlation, tt.correlation) {
+			t.Errorf("%s: excess %v beta %v correlation %v, want %v %v %v",
+				tt.name, c.ExcessReturn, c.Beta, c.Correlation, tt.excess, tt.beta, tt.correlation)
+		}
+	}
+}
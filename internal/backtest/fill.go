@@ -0,0 +1,70 @@
+package backtest
+
+import (
+	"tinkoff-invest-bot/internal/strategy"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// FillPrice по какой цене исполняются заявки в бэктесте
+type FillPrice int
+
+const (
+	FillOnClose    FillPrice = iota // по закрытию свечи, на которой появился сигнал
+	FillOnNextOpen                  // по открытию следующей свечи, как рыночная заявка в торговле
+)
+
+// SlippageType в чём задаётся проскальзывание
+type SlippageType int
+
+const (
+	SlippagePercent SlippageType = iota // процент от цены
+	SlippageTicks                       // количество шагов цены инструмента
+)
+
+// CommissionTariffs комиссия брокера за сделку в процентах от её объёма по тарифам Тинькофф Инвестиций
+var (
+	CommissionTariffs     = []string{"Инвестор", "Трейдер", "Премиум"}
+	CommissionTariffsRate = []decimal.Decimal{
+		decimal.RequireFromString("0.3"),
+		decimal.RequireFromString("0.05"),
+		decimal.RequireFromString("0.04"),
+	}
+)
+
+// FillModel модель исполнения заявок в бэктесте
+type FillModel struct {
+	Price             FillPrice
+	SlippageType      SlippageType
+	Slippage          decimal.Decimal // проскальзывание в процентах или шагах цены, всегда против нас
+	CommissionPercent decimal.Decimal // комиссия брокера в процентах от объёма сделки
+}
+
+// DefaultFillModel исполнение по открытию следующей свечи без проскальзывания с комиссией тарифа Инвестор
+var DefaultFillModel = FillModel{
+	Price:             FillOnNextOpen,
+	SlippageType:      SlippagePercent,
+	CommissionPercent: CommissionTariffsRate[0],
+}
+
+// ExecutionPrice цена исполнения заявки с учётом проскальзывания. Покупка округляется вверх до шага цены,
+// продажа вниз, то есть округление тоже не в нашу пользу
+func (m FillModel) ExecutionPrice(op strategy.Operation, price decimal.Decimal, instrument *sdk.InstrumentInfo) decimal.Decimal {
+	var slippage decimal.Decimal
+	switch m.SlippageType {
+	case SlippagePercent:
+		slippage = price.Mul(m.Slippage).DivInt(100)
+	case SlippageTicks:
+		slippage = instrument.MinPriceIncrement.Mul(m.Slippage)
+	}
+
+	if op == strategy.Buy {
+		return instrument.CeilPrice(price.Add(slippage))
+	}
+	return instrument.FloorPrice(price.Sub(slippage))
+}
+
+// Commission комиссия брокера за сделку объёмом value
+func (m FillModel) Commission(value decimal.Decimal) decimal.Decimal {
+	return value.Mul(m.CommissionPercent).DivInt(100)
+}
@@ -0,0 +1,71 @@
+package backtest
+
+import (
+	"testing"
+
+	"tinkoff-invest-bot/internal/strategy"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+func TestExecutionPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     FillModel
+		increment string
+		price     string
+		buy, sell string
+	}{
+		{name: "no slippage", model: FillModel{}, increment: "0.01", price: "100", buy: "100", sell: "100"},
+		{name: "off step price", model: FillModel{}, increment: "0.01", price: "123.456", buy: "123.46", sell: "123.45"},
+		{
+			name:      "percent",
+			model:     FillModel{SlippageType: SlippagePercent, Slippage: decimal.RequireFromString("0.1")},
+			increment: "0.01", price: "100", buy: "100.1", sell: "99.9",
+		},
+		{
+			name:      "percent rounded against us",
+			model:     FillModel{SlippageType: SlippagePercent, Slippage: decimal.RequireFromString("0.05")},
+			increment: "0.01", price: "99.99", buy: "100.04", sell: "99.94",
+		},
+		{
+			name:      "ticks",
+			model:     FillModel{SlippageType: SlippageTicks, Slippage: decimal.RequireFromString("2")},
+			increment: "0.05", price: "100", buy: "100.1", sell: "99.9",
+		},
+		{
+			name:      "ticks from off step price",
+			model:     FillModel{SlippageType: SlippageTicks, Slippage: decimal.RequireFromString("1")},
+			increment: "0.05", price: "100.02", buy: "100.1", sell: "99.95",
+		},
+	}
+	for _, tt := range tests {
+		instrument := &sdk.InstrumentInfo{Lot: 10, MinPriceIncrement: decimal.RequireFromString(tt.increment)}
+		price := decimal.RequireFromString(tt.price)
+		if got := tt.model.ExecutionPrice(strategy.Buy, price, instrument).String(); got != tt.buy {
+			t.Errorf("%s: buy at %s, want %s", tt.name, got, tt.buy)
+		}
+		if got := tt.model.ExecutionPrice(strategy.Sell, price, instrument).String(); got != tt.sell {
+			t.Errorf("%s: sell at %s, want %s", tt.name, got, tt.sell)
+		}
+	}
+}
+
+func TestCommission(t *testing.T) {
+	tests := []struct {
+		percent string
+		value   string
+		want    string
+	}{
+		{percent: "0.3", value: "10010", want: "30.03"},
+		{percent: "0.05", value: "1234.5", want: "0.61725"},
+		{percent: "0.04", value: "0.01", want: "0.000004"},
+		{percent: "0", value: "1000", want: "0"},
+	}
+	for _, tt := range tests {
+		model := FillModel{CommissionPercent: decimal.RequireFromString(tt.percent)}
+		if got := model.Commission(decimal.RequireFromString(tt.value)).String(); got != tt.want {
+			t.Errorf("Commission(%s%% of %s) = %s, want %s", tt.percent, tt.value, got, tt.want)
+		}
+	}
+}
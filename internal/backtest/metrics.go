@@ -0,0 +1,151 @@
+package backtest
+
+import (
+	"math"
+	"time"
+
+	"github.com/sdcoffey/techan"
+
+	"tinkoff-invest-bot/pkg/decimal"
+)
+
+const year = 365 * 24 * time.Hour
+
+// EquityPoint стоимость счёта бэктеста на закрытии свечи: деньги плюс позиция по цене закрытия
+type EquityPoint struct {
+	Time  time.Time
+	Value decimal.Decimal
+}
+
+// Metrics показатели эффективности стратегии за период бэктеста. Доли указаны в долях единицы, а не в процентах
+type Metrics struct {
+	TotalReturn      float64         // доходность за весь период
+	AnnualizedReturn float64         // доходность в пересчёте на год
+	MaxDrawdown      float64         // максимальная просадка от пика стоимости счёта
+	Sharpe           float64         // коэффициент Шарпа в пересчёте на год, безрисковая ставка 0
+	Sortino          float64         // коэффициент Сортино в пересчёте на год
+	WinRate          float64         // доля прибыльных сделок
+	ProfitFactor     float64         // прибыль прибыльных сделок к убытку убыточных, +Inf если убыточных нет
+	AverageTrade     decimal.Decimal // средний доход сделки в деньгах
+	Exposure         float64         // доля времени, которое стратегия была в позиции
+	Trades           int             // количество закрытых сделок
+}
+
+// ComputeMetrics вычисляет показатели по истории трейдинга стратегии, закрытым сделкам и кривой стоимости счёта
+func ComputeMetrics(record *techan.TradingRecord, trades []Trade, equity []EquityPoint) Metrics {
+	var m Metrics
+	m.Trades = len(trades)
+	if len(equity) == 0 {
+		return m
+	}
+
+	start, end := equity[0], equity[len(equity)-1]
+	initial := start.Value.Float()
+	if initial > 0 {
+		m.TotalReturn = end.Value.Float()/initial - 1
+	}
+	years := float64(end.Time.Sub(start.Time)) / float64(year)
+	if years > 0 && m.TotalReturn > -1 {
+		m.AnnualizedReturn = math.Pow(1+m.TotalReturn, 1/years) - 1
+	}
+
+	m.MaxDrawdown = maxDrawdown(equity)
+	returns := equityReturns(equity)
+	if years > 0 && len(returns) > 0 {
+		periodsPerYear := float64(len(returns)) / years // торговля идёт не круглосуточно, поэтому считаем по факту
+		m.Sharpe, m.Sortino = sharpeSortino(returns, periodsPerYear)
+	}
+
+	wins, grossProfit, grossLoss, total := 0, decimal.Zero, decimal.Zero, decimal.Zero
+	for _, trade := range trades {
+		total = total.Add(trade.PnL)
+		if trade.PnL.Sign() > 0 {
+			wins++
+			grossProfit = grossProfit.Add(trade.PnL)
+		} else {
+			grossLoss = grossLoss.Sub(trade.PnL)
+		}
+	}
+	if len(trades) > 0 {
+		m.WinRate = float64(wins) / float64(len(trades))
+		m.AverageTrade = total.DivInt(int64(len(trades)))
+		switch {
+		case grossLoss.Sign() > 0:
+			m.ProfitFactor = grossProfit.Div(grossLoss).Float()
+		case grossProfit.Sign() > 0:
+			m.ProfitFactor = math.Inf(1)
+		}
+	}
+
+	m.Exposure = exposure(record, start.Time, end.Time)
+	return m
+}
+
+// equityReturns доходности между соседними точками кривой стоимости счёта
+func equityReturns(equity []EquityPoint) []float64 {
+	returns := make([]float64, 0, len(equity))
+	for i := 1; i < len(equity); i++ {
+		prev := equity[i-1].Value.Float()
+		if prev <= 0 {
+			continue
+		}
+		returns = append(returns, equity[i].Value.Float()/prev-1)
+	}
+	return returns
+}
+
+func maxDrawdown(equity []EquityPoint) float64 {
+	peak, drawdown := 0.0, 0.0
+	for _, point := range equity {
+		value := point.Value.Float()
+		if value > peak {
+			peak = value
+		}
+		if peak > 0 && 1-value/peak > drawdown {
+			drawdown = 1 - value/peak
+		}
+	}
+	return drawdown
+}
+
+func sharpeSortino(returns []float64, periodsPerYear float64) (float64, float64) {
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance, downside float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	std := math.Sqrt(variance / float64(len(returns)))
+	downsideStd := math.Sqrt(downside / float64(len(returns)))
+
+	var sharpe, sortino float64
+	if std > 0 {
+		sharpe = mean / std * math.Sqrt(periodsPerYear)
+	}
+	if downsideStd > 0 {
+		sortino = mean / downsideStd * math.Sqrt(periodsPerYear)
+	}
+	return sharpe, sortino
+}
+
+// exposure доля времени между from и to, которое была открыта позиция по истории трейдинга
+func exposure(record *techan.TradingRecord, from time.Time, to time.Time) float64 {
+	if record == nil || !to.After(from) {
+		return 0
+	}
+	var inPosition time.Duration
+	for _, position := range record.Trades {
+		inPosition += position.ExitOrder().ExecutionTime.Sub(position.EntranceOrder().ExecutionTime)
+	}
+	if current := record.CurrentPosition(); current.IsOpen() {
+		inPosition += to.Sub(current.EntranceOrder().ExecutionTime)
+	}
+	return float64(inPosition) / float64(to.Sub(from))
+}
@@ -0,0 +1,123 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sdcoffey/big"
+	"github.com/sdcoffey/techan"
+
+	"tinkoff-invest-bot/pkg/decimal"
+)
+
+var metricsStart = time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC)
+
+// equityCurve кривая стоимости счёта из values с точками через равные доли года
+func equityCurve(values ...string) []EquityPoint {
+	equity := make([]EquityPoint, len(values))
+	for i, v := range values {
+		equity[i] = EquityPoint{
+			Time:  metricsStart.Add(time.Duration(i) * year / time.Duration(len(values)-1)),
+			Value: decimal.RequireFromString(v),
+		}
+	}
+	return equity
+}
+
+func tradesWithPnL(pnl ...string) []Trade {
+	trades := make([]Trade, len(pnl))
+	for i, p := range pnl {
+		trades[i] = Trade{PnL: decimal.RequireFromString(p)}
+	}
+	return trades
+}
+
+func almostEqual(a float64, b float64) bool {
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return a == b
+	}
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestComputeMetrics(t *testing.T) {
+	// доходности 0.1, -0.1, 2/9 за три трети года: среднее 2/27, std 0.13281793390400823,
+	// std убытков sqrt(0.01/3), на год приходится 3 доходности
+	equity := equityCurve("100", "110", "99", "121")
+
+	tests := []struct {
+		name   string
+		equity []EquityPoint
+		trades []Trade
+		got    func(m Metrics) float64
+		want   float64
+	}{
+		{name: "total return", equity: equity, got: func(m Metrics) float64 { return m.TotalReturn }, want: 0.21},
+		{name: "annualized return over a year", equity: equity, got: func(m Metrics) float64 { return m.AnnualizedReturn }, want: 0.21},
+		{
+			name:   "annualized return over two years",
+			equity: []EquityPoint{{Time: metricsStart, Value: decimal.NewFromInt(100)}, {Time: metricsStart.Add(2 * year), Value: decimal.NewFromInt(121)}},
+			got:    func(m Metrics) float64 { return m.AnnualizedReturn },
+			want:   0.1,
+		},
+		{name: "max drawdown", equity: equity, got: func(m Metrics) float64 { return m.MaxDrawdown }, want: 0.1},
+		{
+			name:   "max drawdown from the highest peak",
+			equity: equityCurve("100", "120", "110", "115", "90", "130"),
+			got:    func(m Metrics) float64 { return m.MaxDrawdown },
+			want:   0.25,
+		},
+		{name: "no drawdown", equity: equityCurve("100", "101", "102"), got: func(m Metrics) float64 { return m.MaxDrawdown }, want: 0},
+		{name: "sharpe", equity: equity, got: func(m Metrics) float64 { return m.Sharpe }, want: 0.9659844574351192},
+		{name: "sortino", equity: equity, got: func(m Metrics) float64 { return m.Sortino }, want: 20.0 / 9},
+		{name: "sortino without losses", equity: equityCurve("100", "101", "103"), got: func(m Metrics) float64 { return m.Sortino }, want: 0},
+		{name: "flat sharpe", equity: equityCurve("100", "100", "100"), got: func(m Metrics) float64 { return m.Sharpe }, want: 0},
+		{name: "win rate", equity: equity, trades: tradesWithPnL("30", "-10", "20"), got: func(m Metrics) float64 { return m.WinRate }, want: 2.0 / 3},
+		{name: "profit factor", equity: equity, trades: tradesWithPnL("30", "-10", "20"), got: func(m Metrics) float64 { return m.ProfitFactor }, want: 5},
+		{name: "profit factor without losses", equity: equity, trades: tradesWithPnL("30", "20"), got: func(m Metrics) float64 { return m.ProfitFactor }, want: math.Inf(1)},
+		{name: "profit factor without profits", equity: equity, trades: tradesWithPnL("-30"), got: func(m Metrics) float64 { return m.ProfitFactor }, want: 0},
+		{name: "zero trade is a loss", equity: equity, trades: tradesWithPnL("10", "0"), got: func(m Metrics) float64 { return m.WinRate }, want: 0.5},
+		{name: "exposure without record", equity: equity, got: func(m Metrics) float64 { return m.Exposure }, want: 0},
+		{name: "empty equity", got: func(m Metrics) float64 { return m.TotalReturn }, want: 0},
+	}
+	for _, tt := range tests {
+		m := ComputeMetrics(nil, tt.trades, tt.equity)
+		if got := tt.got(m); !almostEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestComputeMetricsAverageTrade(t *testing.T) {
+	m := ComputeMetrics(nil, tradesWithPnL("30", "-10", "20"), equityCurve("100", "121"))
+	if m.Trades != 3 || m.AverageTrade.String() != "13.333333333" {
+		t.Errorf("trades %d, average trade %s, want 3 and 13.333333333", m.Trades, m.AverageTrade)
+	}
+}
+
+func TestExposure(t *testing.T) {
+	// позиция открыта с трети до двух третей года и снова с пяти шестых до конца периода
+	record := techan.NewTradingRecord()
+	orders := []struct {
+		side techan.OrderSide
+		at   time.Duration
+	}{
+		{side: techan.BUY, at: year / 3},
+		{side: techan.SELL, at: 2 * year / 3},
+		{side: techan.BUY, at: 5 * year / 6},
+	}
+	for _, o := range orders {
+		record.Operate(techan.Order{
+			Side:          o.side,
+			Security:      backtestOrderId,
+			Price:         big.NewFromInt(100),
+			Amount:        big.NewFromInt(1),
+			ExecutionTime: metricsStart.Add(o.at),
+		})
+	}
+
+	m := ComputeMetrics(record, nil, equityCurve("100", "100"))
+	if !almostEqual(m.Exposure, 0.5) {
+		t.Errorf("exposure %v, want 0.5", m.Exposure)
+	}
+}
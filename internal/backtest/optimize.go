@@ -0,0 +1,153 @@
+package backtest
+
+import (
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/internal/rule-strategy"
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// ParameterRange значения параметра стратегии для перебора: от From до To включительно с шагом Step
+type ParameterRange struct {
+	Name string
+	From int
+	To   int
+	Step int
+}
+
+// Objective показатель, по которому ранжируются результаты подбора параметров, больше значит лучше
+type Objective struct {
+	Title string
+	Value func(m Metrics) float64
+}
+
+// Objectives показатели, доступные для подбора параметров
+var Objectives = []Objective{
+	{Title: "Доходность", Value: func(m Metrics) float64 { return m.TotalReturn }},
+	{Title: "Коэффициент Шарпа", Value: func(m Metrics) float64 { return m.Sharpe }},
+	{Title: "Коэффициент Сортино", Value: func(m Metrics) float64 { return m.Sortino }},
+	{Title: "Профит-фактор", Value: func(m Metrics) float64 { return m.ProfitFactor }},
+	{Title: "Доходность к максимальной просадке", Value: func(m Metrics) float64 {
+		if m.MaxDrawdown == 0 {
+			return m.TotalReturn
+		}
+		return m.TotalReturn / m.MaxDrawdown
+	}},
+}
+
+// OptimizationResult результат бэктеста с одним набором параметров
+type OptimizationResult struct {
+	Other   map[string]int
+	Metrics Metrics
+	PnL     decimal.Decimal // доход по закрытым сделкам за вычетом комиссии
+	Score   float64         // значение показателя, по которому ранжируются результаты
+}
+
+// Optimize перебирает все сочетания параметров стратегии из ranges, параллельно прогоняет бэктест для каждого
+// и возвращает результаты, отсортированные по objective от лучшего к худшему.
+// Неподходящие сочетания, например короткое окно больше длинного, пропускаются
+func Optimize(
+	tradingConfig *config.TradingConfig,
+	instrument *sdk.InstrumentInfo,
+	candles []*investapi.HistoricCandle,
+	model FillModel,
+	capital decimal.Decimal,
+	ranges []ParameterRange,
+	objective Objective,
+	logger *zap.Logger,
+) ([]OptimizationResult, error) {
+	for _, r := range ranges {
+		if r.Step <= 0 || r.From > r.To {
+			return nil, xerrors.Errorf("invalid range for %s: from %d to %d step %d", r.Name, r.From, r.To, r.Step)
+		}
+	}
+
+	var combinations []map[string]int
+	for _, other := range parameterGrid(ranges) {
+		if rule_strategy.IsValidParameters(other) {
+			combinations = append(combinations, other)
+		}
+	}
+
+	results := make([]OptimizationResult, len(combinations))
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	jobs := make(chan int)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				conf := *tradingConfig
+				conf.StrategyConfig.Other = combinations[idx]
+				result, err := Run(&conf, instrument, candles, model, capital, logger)
+				if err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					continue
+				}
+				metrics := result.Metrics()
+				results[idx] = OptimizationResult{
+					Other:   combinations[idx],
+					Metrics: metrics,
+					PnL:     result.PnL,
+					Score:   objective.Value(metrics),
+				}
+			}
+		}()
+	}
+	for i := range combinations {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return better(results[i].Score, results[j].Score)
+	})
+	return results, nil
+}
+
+// better лучше ли значение a значения b, NaN хуже любого числа
+func better(a float64, b float64) bool {
+	if math.IsNaN(b) {
+		return !math.IsNaN(a)
+	}
+	return a > b
+}
+
+// parameterGrid все сочетания значений параметров
+func parameterGrid(ranges []ParameterRange) []map[string]int {
+	grid := []map[string]int{{}}
+	for _, r := range ranges {
+		var next []map[string]int
+		for _, other := range grid {
+			for v := r.From; v <= r.To; v += r.Step {
+				combination := make(map[string]int, len(other)+1)
+				for name, value := range other {
+					combination[name] = value
+				}
+				combination[r.Name] = v
+				next = append(next, combination)
+			}
+		}
+		grid = next
+	}
+	return grid
+}
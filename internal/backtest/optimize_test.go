@@ -0,0 +1,71 @@
+package backtest
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParameterGrid(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []ParameterRange
+		want   []map[string]int
+	}{
+		{name: "no parameters", want: []map[string]int{{}}},
+		{
+			name:   "one parameter",
+			ranges: []ParameterRange{{Name: "window", From: 5, To: 11, Step: 3}},
+			want:   []map[string]int{{"window": 5}, {"window": 8}, {"window": 11}},
+		},
+		{
+			name:   "step past the end",
+			ranges: []ParameterRange{{Name: "window", From: 5, To: 10, Step: 3}},
+			want:   []map[string]int{{"window": 5}, {"window": 8}},
+		},
+		{
+			name: "cartesian product",
+			ranges: []ParameterRange{
+				{Name: "short_window", From: 1, To: 2, Step: 1},
+				{Name: "long_window", From: 10, To: 20, Step: 10},
+			},
+			want: []map[string]int{
+				{"short_window": 1, "long_window": 10},
+				{"short_window": 1, "long_window": 20},
+				{"short_window": 2, "long_window": 10},
+				{"short_window": 2, "long_window": 20},
+			},
+		},
+		{
+			name:   "empty range",
+			ranges: []ParameterRange{{Name: "window", From: 5, To: 4, Step: 1}},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := parameterGrid(tt.ranges); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBetter(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		a, b float64
+		want bool
+	}{
+		{a: 2, b: 1, want: true},
+		{a: 1, b: 2, want: false},
+		{a: 1, b: 1, want: false},
+		{a: -5, b: nan, want: true},
+		{a: nan, b: -5, want: false},
+		{a: nan, b: nan, want: false},
+		{a: math.Inf(1), b: 100, want: true},
+	}
+	for _, tt := range tests {
+		if got := better(tt.a, tt.b); got != tt.want {
+			t.Errorf("better(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/pkg/decimal"
+)
+
+// Report результат бэктеста в машиночитаемом виде для JSON и CSV
+type Report struct {
+	Ticker     string         `json:"ticker"`
+	Figi       string         `json:"figi"`
+	AccountId  string         `json:"account_id"`
+	Strategy   string         `json:"strategy"`
+	Interval   string         `json:"interval"`
+	Parameters map[string]int `json:"parameters"`
+	Currency   string         `json:"currency"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+
+	InitialCapital decimal.Decimal `json:"initial_capital"`
+	Commission     decimal.Decimal `json:"commission"`
+	PnL            decimal.Decimal `json:"pnl"`
+	Metrics        ReportMetrics   `json:"metrics"`
+	Trades         []ReportTrade   `json:"trades"`
+	OpenTrade      *ReportTrade    `json:"open_trade"`
+	Equity         []ReportEquity  `json:"equity"`
+	Benchmark      ReportBenchmark `json:"benchmark"`
+}
+
+// ReportBenchmark покупка и удержание инструмента и сравнение стратегии с ней
+type ReportBenchmark struct {
+	Lots             int64           `json:"lots"`
+	EntryPrice       decimal.Decimal `json:"entry_price"`
+	Commission       decimal.Decimal `json:"commission"`
+	TotalReturn      *float64        `json:"total_return"`
+	AnnualizedReturn *float64        `json:"annualized_return"`
+	MaxDrawdown      *float64        `json:"max_drawdown"`
+	ExcessReturn     *float64        `json:"excess_return"`
+	Beta             *float64        `json:"beta"`
+	Correlation      *float64        `json:"correlation"`
+	Equity           []ReportEquity  `json:"equity"`
+}
+
+// ReportMetrics показатели стратегии. Значения, которые нельзя посчитать, например профит-фактор
+// без убыточных сделок, равны null
+type ReportMetrics struct {
+	TotalReturn      *float64        `json:"total_return"`
+	AnnualizedReturn *float64        `json:"annualized_return"`
+	MaxDrawdown      *float64        `json:"max_drawdown"`
+	Sharpe           *float64        `json:"sharpe"`
+	Sortino          *float64        `json:"sortino"`
+	WinRate          *float64        `json:"win_rate"`
+	ProfitFactor     *float64        `json:"profit_factor"`
+	AverageTrade     decimal.Decimal `json:"average_trade"`
+	Exposure         *float64        `json:"exposure"`
+	Trades           int             `json:"trades"`
+}
+
+type ReportTrade struct {
+	EntryTime  time.Time       `json:"entry_time"`
+	ExitTime   time.Time       `json:"exit_time"`
+	EntryPrice decimal.Decimal `json:"entry_price"`
+	ExitPrice  decimal.Decimal `json:"exit_price"`
+	Lots       int64           `json:"lots"`
+	Commission decimal.Decimal `json:"commission"`
+	PnL        decimal.Decimal `json:"pnl"`
+}
+
+type ReportEquity struct {
+	Time  time.Time       `json:"time"`
+	Value decimal.Decimal `json:"value"`
+}
+
+// NewReport собирает отчёт по результату бэктеста конфига tradingConfig за период [from, to)
+func NewReport(tradingConfig *config.TradingConfig, from time.Time, to time.Time, result *Result) *Report {
+	r := &Report{
+		Ticker:         tradingConfig.Ticker,
+		Figi:           tradingConfig.Figi,
+		AccountId:      tradingConfig.AccountId,
+		Strategy:       tradingConfig.StrategyConfig.Name,
+		Interval:       tradingConfig.StrategyConfig.Interval,
+		Parameters:     tradingConfig.StrategyConfig.Other,
+		Currency:       tradingConfig.Currency,
+		From:           from,
+		To:             to,
+		InitialCapital: result.InitialCapital,
+		Commission:     result.Commission,
+		PnL:            result.PnL,
+		Metrics:        newReportMetrics(result.Metrics()),
+		Trades:         make([]ReportTrade, 0, len(result.Trades)),
+		Equity:         make([]ReportEquity, 0, len(result.Equity)),
+	}
+	for _, trade := range result.Trades {
+		r.Trades = append(r.Trades, ReportTrade(trade))
+	}
+	if result.OpenTrade != nil {
+		open := ReportTrade(*result.OpenTrade)
+		r.OpenTrade = &open
+	}
+	for _, point := range result.Equity {
+		r.Equity = append(r.Equity, ReportEquity(point))
+	}
+
+	comparison := result.Comparison()
+	r.Benchmark = ReportBenchmark{
+		Lots:             result.Benchmark.Lots,
+		EntryPrice:       result.Benchmark.EntryPrice,
+		Commission:       result.Benchmark.Commission,
+		TotalReturn:      finite(comparison.Benchmark.TotalReturn),
+		AnnualizedReturn: finite(comparison.Benchmark.AnnualizedReturn),
+		MaxDrawdown:      finite(comparison.Benchmark.MaxDrawdown),
+		ExcessReturn:     finite(comparison.ExcessReturn),
+		Beta:             finite(comparison.Beta),
+		Correlation:      finite(comparison.Correlation),
+		Equity:           make([]ReportEquity, 0, len(result.Benchmark.Equity)),
+	}
+	for _, point := range result.Benchmark.Equity {
+		r.Benchmark.Equity = append(r.Benchmark.Equity, ReportEquity(point))
+	}
+	return r
+}
+
+func newReportMetrics(m Metrics) ReportMetrics {
+	return ReportMetrics{
+		TotalReturn:      finite(m.TotalReturn),
+		AnnualizedReturn: finite(m.AnnualizedReturn),
+		MaxDrawdown:      finite(m.MaxDrawdown),
+		Sharpe:           finite(m.Sharpe),
+		Sortino:          finite(m.Sortino),
+		WinRate:          finite(m.WinRate),
+		ProfitFactor:     finite(m.ProfitFactor),
+		AverageTrade:     m.AverageTrade,
+		Exposure:         finite(m.Exposure),
+		Trades:           m.Trades,
+	}
+}
+
+// finite nil для бесконечности и NaN, которые нельзя записать в JSON
+func finite(f float64) *float64 {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil
+	}
+	return &f
+}
+
+// WriteJSON записывает отчёт в JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV записывает в директорию dir три файла: prefix_trades.csv со сделками,
+// prefix_metrics.csv с показателями в формате name,value и prefix_equity.csv с кривой стоимости счёта
+// и кривой покупки и удержания
+func (r *Report) WriteCSV(dir string, prefix string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	trades := [][]string{{"entry_time", "exit_time", "entry_price", "exit_price", "lots", "commission", "pnl", "open"}}
+	addTrade := func(t ReportTrade, open bool) {
+		trades = append(trades, []string{
+			t.EntryTime.Format(time.RFC3339), t.ExitTime.Format(time.RFC3339),
+			t.EntryPrice.String(), t.ExitPrice.String(), strconv.FormatInt(t.Lots, 10),
+			t.Commission.String(), t.PnL.String(), strconv.FormatBool(open),
+		})
+	}
+	for _, t := range r.Trades {
+		addTrade(t, false)
+	}
+	if r.OpenTrade != nil {
+		addTrade(*r.OpenTrade, true)
+	}
+
+	m := r.Metrics
+	metrics := [][]string{
+		{"name", "value"},
+		{"initial_capital", r.InitialCapital.String()},
+		{"commission", r.Commission.String()},
+		{"pnl", r.PnL.String()},
+		{"total_return", formatMetric(m.TotalReturn)},
+		{"annualized_return", formatMetric(m.AnnualizedReturn)},
+		{"max_drawdown", formatMetric(m.MaxDrawdown)},
+		{"sharpe", formatMetric(m.Sharpe)},
+		{"sortino", formatMetric(m.Sortino)},
+		{"win_rate", formatMetric(m.WinRate)},
+		{"profit_factor", formatMetric(m.ProfitFactor)},
+		{"average_trade", m.AverageTrade.String()},
+		{"exposure", formatMetric(m.Exposure)},
+		{"trades", strconv.Itoa(m.Trades)},
+		{"benchmark_lots", strconv.FormatInt(r.Benchmark.Lots, 10)},
+		{"benchmark_total_return", formatMetric(r.Benchmark.TotalReturn)},
+		{"benchmark_annualized_return", formatMetric(r.Benchmark.AnnualizedReturn)},
+		{"benchmark_max_drawdown", formatMetric(r.Benchmark.MaxDrawdown)},
+		{"excess_return", formatMetric(r.Benchmark.ExcessReturn)},
+		{"beta", formatMetric(r.Benchmark.Beta)},
+		{"correlation", formatMetric(r.Benchmark.Correlation)},
+	}
+
+	// кривая покупки и удержания строится по тем же свечам, поэтому её точки совпадают по времени
+	equity := [][]string{{"time", "value", "benchmark"}}
+	for i, point := range r.Equity {
+		var benchmark string
+		if i < len(r.Benchmark.Equity) {
+			benchmark = r.Benchmark.Equity[i].Value.String()
+		}
+		equity = append(equity, []string{point.Time.Format(time.RFC3339), point.Value.String(), benchmark})
+	}
+
+	for name, records := range map[string][][]string{"trades": trades, "metrics": metrics, "equity": equity} {
+		if err := writeCSVFile(filepath.Join(dir, prefix+"_"+name+".csv"), records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatMetric(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func writeCSVFile(path string, records [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = csv.NewWriter(f).WriteAll(records); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// BatchReport результат пакетного бэктеста: отчёты по конфигам от лучшего к худшему и счета аккаунтов
+type BatchReport struct {
+	Configs  []*Report        `json:"configs"`
+	Failed   []BatchFailure   `json:"failed"`
+	Accounts []*AccountReport `json:"accounts"`
+}
+
+// BatchFailure конфиг, бэктест которого не удался
+type BatchFailure struct {
+	Ticker    string `json:"ticker"`
+	AccountId string `json:"account_id"`
+	Error     string `json:"error"`
+}
+
+// AccountReport стоимость общего счёта конфигов одного аккаунта в одной валюте
+type AccountReport struct {
+	AccountId      string          `json:"account_id"`
+	Currency       string          `json:"currency"`
+	Configs        int             `json:"configs"`
+	InitialCapital decimal.Decimal `json:"initial_capital"`
+	PnL            decimal.Decimal `json:"pnl"`
+	SkippedBuys    int             `json:"skipped_buys"`
+	Metrics        ReportMetrics   `json:"metrics"`
+	Equity         []ReportEquity  `json:"equity"`
+}
+
+// NewBatchReport собирает отчёт по результатам пакетного бэктеста за период [from, to)
+func NewBatchReport(from time.Time, to time.Time, results []BatchResult, accounts []AccountEquity) *BatchReport {
+	r := &BatchReport{Configs: []*Report{}, Failed: []BatchFailure{}, Accounts: []*AccountReport{}}
+	for _, result := range results {
+		if result.Err != nil {
+			r.Failed = append(r.Failed, BatchFailure{
+				Ticker:    result.TradingConfig.Ticker,
+				AccountId: result.TradingConfig.AccountId,
+				Error:     result.Err.Error(),
+			})
+			continue
+		}
+		r.Configs = append(r.Configs, NewReport(result.TradingConfig, from, to, result.Result))
+	}
+	for _, account := range accounts {
+		a := &AccountReport{
+			AccountId:      account.AccountId,
+			Currency:       account.Currency,
+			Configs:        account.Configs,
+			InitialCapital: account.InitialCapital,
+			PnL:            account.PnL,
+			SkippedBuys:    account.SkippedBuys,
+			Metrics:        newReportMetrics(account.Metrics),
+			Equity:         make([]ReportEquity, 0, len(account.Equity)),
+		}
+		for _, point := range account.Equity {
+			a.Equity = append(a.Equity, ReportEquity(point))
+		}
+		r.Accounts = append(r.Accounts, a)
+	}
+	return r
+}
+
+// WriteJSON записывает отчёт в JSON
+func (r *BatchReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV записывает в директорию dir отчёты каждого конфига как Report.WriteCSV, сводку summary.csv
+// с показателями конфигов от лучшего к худшему и account_<id>_<currency>_equity.csv со стоимостью общих счетов аккаунтов
+func (r *BatchReport) WriteCSV(dir string) error {
+	summary := [][]string{{
+		"rank", "ticker", "account_id", "strategy", "interval", "currency", "pnl", "total_return",
+		"max_drawdown", "sharpe", "sortino", "win_rate", "profit_factor", "trades", "excess_return", "beta",
+	}}
+	for i, c := range r.Configs {
+		if err := c.WriteCSV(dir, c.Ticker+"_"+c.AccountId); err != nil {
+			return err
+		}
+		m := c.Metrics
+		summary = append(summary, []string{
+			strconv.Itoa(i + 1), c.Ticker, c.AccountId, c.Strategy, c.Interval, c.Currency, c.PnL.String(),
+			formatMetric(m.TotalReturn), formatMetric(m.MaxDrawdown), formatMetric(m.Sharpe), formatMetric(m.Sortino),
+			formatMetric(m.WinRate), formatMetric(m.ProfitFactor), strconv.Itoa(m.Trades),
+			formatMetric(c.Benchmark.ExcessReturn), formatMetric(c.Benchmark.Beta),
+		})
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := writeCSVFile(filepath.Join(dir, "summary.csv"), summary); err != nil {
+		return err
+	}
+
+	for _, a := range r.Accounts {
+		equity := [][]string{{"time", "value"}}
+		for _, point := range a.Equity {
+			equity = append(equity, []string{point.Time.Format(time.RFC3339), point.Value.String()})
+		}
+		path := filepath.Join(dir, "account_"+a.AccountId+"_"+a.Currency+"_equity.csv")
+		if err := writeCSVFile(path, equity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package backtest
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/internal/strategy"
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// trader прогон стратегии одного конфига по свечам: сигналы, исполнение заявок по модели и открытая позиция.
+// Деньги хранятся у вызывающего, поэтому несколько конфигов одного аккаунта могут торговать с общего счёта
+type trader struct {
+	result     *Result
+	processor  *strategy.CandlesStrategyProcessor
+	instrument *sdk.InstrumentInfo
+	model      FillModel
+	lots       int64
+	units      int64
+	period     time.Duration
+
+	open        *Trade
+	pending     strategy.Operation // сигнал, ожидающий исполнения по открытию следующей свечи
+	last        *investapi.HistoricCandle
+	skippedBuys int  // покупки, на которые не хватило денег, сигналы на покупку подряд считаются за одну
+	starved     bool // на предыдущей свече покупка была пропущена из-за нехватки денег
+}
+
+// newTrader создаёт стратегию из трейдинг конфига и разогревает её индикаторы свечами warmUp без торговли
+func newTrader(
+	tradingConfig *config.TradingConfig,
+	instrument *sdk.InstrumentInfo,
+	warmUp []*investapi.HistoricCandle,
+	model FillModel,
+	capital decimal.Decimal,
+	logger *zap.Logger,
+) (*trader, error) {
+	processor, err := strategy.FromInstrument(tradingConfig, instrument, nil, nil, logger)
+	if err != nil {
+		return nil, err
+	}
+	t := &trader{
+		result:     &Result{Processor: processor, Instrument: instrument, InitialCapital: capital},
+		processor:  processor,
+		instrument: instrument,
+		model:      model,
+		lots:       tradingConfig.StrategyConfig.Quantity,
+		units:      instrument.LotsToUnits(tradingConfig.StrategyConfig.Quantity),
+		period:     sdk.IntervalToDuration(tradingConfig.StrategyConfig.Interval),
+		pending:    strategy.Hold,
+	}
+	processor.Init(strategy.HistoricCandlesToTechanCandles(warmUp, t.period))
+	return t, nil
+}
+
+// fill исполняет заявку op по цене price, деньги списываются с cash и зачисляются на него.
+// Если limited, покупка, на которую денег не хватает, пропускается, как в торговле при проверке баланса
+func (t *trader) fill(op strategy.Operation, price decimal.Decimal, at time.Time, cash *decimal.Decimal, limited bool) {
+	executed := t.model.ExecutionPrice(op, price, t.instrument)
+	commission := t.model.Commission(executed.MulInt(t.units))
+
+	if op == strategy.Buy {
+		cost := executed.MulInt(t.units).Add(commission)
+		if limited && cost.GreaterThan(*cash) {
+			if !t.starved {
+				t.skippedBuys++
+			}
+			t.starved = true
+			return
+		}
+		t.processor.AddEvent(op, backtestOrderId, executed, t.lots)
+		t.result.Commission = t.result.Commission.Add(commission)
+		*cash = cash.Sub(cost)
+		t.open = &Trade{EntryTime: at, EntryPrice: executed, Lots: t.lots, Commission: commission}
+		return
+	}
+	t.processor.AddEvent(op, backtestOrderId, executed, t.lots)
+	t.result.Commission = t.result.Commission.Add(commission)
+	*cash = cash.Add(executed.MulInt(t.units)).Sub(commission)
+	t.open.ExitTime = at
+	t.open.ExitPrice = executed
+	t.open.Commission = t.open.Commission.Add(commission)
+	t.open.PnL = executed.Sub(t.open.EntryPrice).MulInt(t.units).Sub(t.open.Commission)
+	t.result.Trades = append(t.result.Trades, *t.open)
+	t.result.PnL = t.result.PnL.Add(t.open.PnL)
+	t.open = nil
+}
+
+// step обрабатывает закрытую свечу: исполняет отложенный сигнал по её открытию и вычисляет сигнал на закрытии
+func (t *trader) step(candle *investapi.HistoricCandle, cash *decimal.Decimal, limited bool) {
+	buying := t.pending == strategy.Buy
+	if t.pending != strategy.Hold {
+		t.fill(t.pending, sdk.QuotationToDecimal(candle.GetOpen()), candle.GetTime().AsTime(), cash, limited)
+		t.pending = strategy.Hold
+	}
+
+	op := t.processor.Step(strategy.HistoricCandleToTechanCandle(candle, t.period), false)
+	t.last = candle
+	if op == strategy.Buy && t.open == nil || op == strategy.Sell && t.open != nil {
+		buying = buying || op == strategy.Buy
+		if t.model.Price == FillOnClose {
+			t.fill(op, sdk.QuotationToDecimal(candle.GetClose()), t.closeTime(candle), cash, limited)
+		} else {
+			t.pending = op
+		}
+	}
+	if !buying || t.open != nil {
+		t.starved = false
+	}
+}
+
+// closeTime время закрытия свечи
+func (t *trader) closeTime(candle *investapi.HistoricCandle) time.Time {
+	return candle.GetTime().AsTime().Add(t.period)
+}
+
+// positionValue стоимость открытой позиции по цене закрытия последней свечи
+func (t *trader) positionValue() decimal.Decimal {
+	if t.open == nil || t.last == nil {
+		return decimal.Zero
+	}
+	return sdk.QuotationToDecimal(t.last.GetClose()).MulInt(t.units)
+}
+
+// finish оценивает позицию, не закрытую к концу периода, по цене закрытия последней свечи
+func (t *trader) finish() {
+	if t.open == nil || t.last == nil {
+		return
+	}
+	t.open.ExitTime = t.closeTime(t.last)
+	t.open.ExitPrice = sdk.QuotationToDecimal(t.last.GetClose())
+	t.open.PnL = t.open.ExitPrice.Sub(t.open.EntryPrice).MulInt(t.units).Sub(t.open.Commission)
+	t.result.OpenTrade = t.open
+}
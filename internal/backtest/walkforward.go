@@ -0,0 +1,202 @@
+package backtest
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// WalkForwardWindow окно walk-forward анализа: параметры подбираются на InSample и проверяются на OutOfSample
+type WalkForwardWindow struct {
+	InSampleFrom    time.Time
+	OutOfSampleFrom time.Time
+	OutOfSampleTo   time.Time
+
+	Other            map[string]int // лучшие параметры на InSample
+	InSampleScore    float64        // значение показателя подбора на InSample
+	InSample         Metrics
+	OutOfSampleScore float64 // значение того же показателя на OutOfSample
+	OutOfSample      Metrics
+	OutOfSamplePnL   decimal.Decimal // доход на OutOfSample, включая оценку открытой позиции
+}
+
+// ParameterStability разброс лучших значений параметра по окнам
+type ParameterStability struct {
+	Name   string
+	Min    int
+	Max    int
+	Mean   float64
+	StdDev float64
+	Values []int // лучшие значения по окнам
+}
+
+// WalkForwardResult результат walk-forward анализа
+type WalkForwardResult struct {
+	Windows   []WalkForwardWindow
+	Equity    []EquityPoint // склеенная стоимость счёта на OutOfSample отрезках
+	Trades    []Trade       // закрытые сделки на OutOfSample отрезках
+	Metrics   Metrics       // показатели по склеенной стоимости счёта
+	Stability []ParameterStability
+
+	// Efficiency отношение годовой доходности на OutOfSample к средней годовой доходности на InSample.
+	// Значение сильно меньше 1 говорит о переобучении параметров
+	Efficiency float64
+}
+
+// WalkForward подбирает параметры стратегии на скользящем окне inSample, проверяет лучшие из них
+// на следующем окне outOfSample и сдвигает окна на outOfSample. Стоимость счёта на проверочных окнах склеивается:
+// каждое окно начинается с капитала, которым закончилось предыдущее, открытая позиция оценивается по цене закрытия
+func WalkForward(
+	tradingConfig *config.TradingConfig,
+	instrument *sdk.InstrumentInfo,
+	candles []*investapi.HistoricCandle,
+	model FillModel,
+	capital decimal.Decimal,
+	ranges []ParameterRange,
+	objective Objective,
+	inSample time.Duration,
+	outOfSample time.Duration,
+	logger *zap.Logger,
+) (*WalkForwardResult, error) {
+	if inSample <= 0 || outOfSample <= 0 {
+		return nil, xerrors.Errorf("invalid walk-forward windows: in-sample %v, out-of-sample %v", inSample, outOfSample)
+	}
+	candles = completeCandles(candles)
+	if len(candles) == 0 {
+		return nil, xerrors.Errorf("no complete candles")
+	}
+	start := candles[0].GetTime().AsTime()
+	end := candles[len(candles)-1].GetTime().AsTime().Add(sdk.IntervalToDuration(tradingConfig.StrategyConfig.Interval))
+
+	result := &WalkForwardResult{}
+	equity := capital
+	var exposure time.Duration
+	var inSampleAnnualized float64
+	for _, window := range walkForwardWindows(start, end, inSample, outOfSample) {
+		inSampleCandles := candlesBetween(candles, window.InSampleFrom, window.OutOfSampleFrom)
+		outOfSampleCandles := candlesBetween(candles, window.OutOfSampleFrom, window.OutOfSampleTo)
+		if len(inSampleCandles) == 0 || len(outOfSampleCandles) == 0 { // например окно пришлось на выходные
+			continue
+		}
+
+		optimized, err := Optimize(tradingConfig, instrument, inSampleCandles, model, equity, ranges, objective, logger)
+		if err != nil {
+			return nil, err
+		}
+		if len(optimized) == 0 {
+			return nil, xerrors.Errorf("no valid parameters combinations")
+		}
+		best := optimized[0]
+		window.Other = best.Other
+		window.InSampleScore = best.Score
+		window.InSample = best.Metrics
+
+		// индикаторы разогреваются на свечах InSample, торговля идёт только на OutOfSample
+		conf := *tradingConfig
+		conf.StrategyConfig.Other = best.Other
+		tested, err := run(&conf, instrument, inSampleCandles, outOfSampleCandles, model, equity, logger)
+		if err != nil {
+			return nil, err
+		}
+		window.OutOfSample = tested.Metrics()
+		window.OutOfSampleScore = objective.Value(window.OutOfSample)
+
+		last := tested.Equity[len(tested.Equity)-1].Value
+		window.OutOfSamplePnL = last.Sub(equity)
+		equity = last
+
+		if len(result.Equity) == 0 {
+			result.Equity = append(result.Equity, tested.Equity[0])
+		}
+		result.Equity = append(result.Equity, tested.Equity[1:]...)
+		result.Trades = append(result.Trades, tested.Trades...)
+		result.Windows = append(result.Windows, window)
+		exposure += time.Duration(window.OutOfSample.Exposure * float64(window.OutOfSampleTo.Sub(window.OutOfSampleFrom)))
+		inSampleAnnualized += window.InSample.AnnualizedReturn
+	}
+	if len(result.Windows) == 0 {
+		return nil, xerrors.Errorf("period is too short for in-sample %v and out-of-sample %v windows", inSample, outOfSample)
+	}
+
+	result.Metrics = ComputeMetrics(nil, result.Trades, result.Equity)
+	tested := result.Windows[len(result.Windows)-1].OutOfSampleTo.Sub(result.Windows[0].OutOfSampleFrom)
+	result.Metrics.Exposure = float64(exposure) / float64(tested)
+	inSampleAnnualized /= float64(len(result.Windows))
+	if inSampleAnnualized != 0 {
+		result.Efficiency = result.Metrics.AnnualizedReturn / inSampleAnnualized
+	}
+	result.Stability = parametersStability(ranges, result.Windows)
+	return result, nil
+}
+
+// walkForwardWindows границы окон на периоде [start, end): окна сдвигаются на outOfSample,
+// последнее проверочное окно обрезается по end, окно без проверочного отрезка не создаётся
+func walkForwardWindows(start time.Time, end time.Time, inSample time.Duration, outOfSample time.Duration) []WalkForwardWindow {
+	var windows []WalkForwardWindow
+	for from := start; from.Add(inSample).Before(end); from = from.Add(outOfSample) {
+		window := WalkForwardWindow{
+			InSampleFrom:    from,
+			OutOfSampleFrom: from.Add(inSample),
+			OutOfSampleTo:   from.Add(inSample + outOfSample),
+		}
+		if window.OutOfSampleTo.After(end) {
+			window.OutOfSampleTo = end
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+func parametersStability(ranges []ParameterRange, windows []WalkForwardWindow) []ParameterStability {
+	stability := make([]ParameterStability, 0, len(ranges))
+	for _, r := range ranges {
+		s := ParameterStability{Name: r.Name, Min: math.MaxInt32, Max: math.MinInt32}
+		for _, window := range windows {
+			v := window.Other[r.Name]
+			s.Values = append(s.Values, v)
+			s.Mean += float64(v)
+			if v < s.Min {
+				s.Min = v
+			}
+			if v > s.Max {
+				s.Max = v
+			}
+		}
+		s.Mean /= float64(len(windows))
+		for _, v := range s.Values {
+			s.StdDev += (float64(v) - s.Mean) * (float64(v) - s.Mean)
+		}
+		s.StdDev = math.Sqrt(s.StdDev / float64(len(windows)))
+		stability = append(stability, s)
+	}
+	return stability
+}
+
+func completeCandles(candles []*investapi.HistoricCandle) []*investapi.HistoricCandle {
+	complete := make([]*investapi.HistoricCandle, 0, len(candles))
+	for _, candle := range candles {
+		if candle.GetIsComplete() {
+			complete = append(complete, candle)
+		}
+	}
+	return complete
+}
+
+// candlesBetween свечи из отсортированного по времени списка, открывшиеся в [from, to)
+func candlesBetween(candles []*investapi.HistoricCandle, from time.Time, to time.Time) []*investapi.HistoricCandle {
+	start := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].GetTime().AsTime().Before(from)
+	})
+	end := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].GetTime().AsTime().Before(to)
+	})
+	return candles[start:end]
+}
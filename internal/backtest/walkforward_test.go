@@ -0,0 +1,110 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"tinkoff-invest-bot/investapi"
+)
+
+func TestWalkForwardWindows(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC)
+	at := func(days int) time.Time { return start.Add(time.Duration(days) * day) }
+
+	// окно задаётся днями от start: начало InSample, начало и конец OutOfSample
+	tests := []struct {
+		name                  string
+		end                   time.Time
+		inSample, outOfSample time.Duration
+		want                  [][3]int
+	}{
+		{
+			name: "windows fit the period", end: at(10), inSample: 4 * day, outOfSample: 2 * day,
+			want: [][3]int{{0, 4, 6}, {2, 6, 8}, {4, 8, 10}},
+		},
+		{
+			name: "last out of sample truncated", end: at(9), inSample: 4 * day, outOfSample: 2 * day,
+			want: [][3]int{{0, 4, 6}, {2, 6, 8}, {4, 8, 9}},
+		},
+		{
+			name: "out of sample longer than in sample", end: at(10), inSample: 2 * day, outOfSample: 3 * day,
+			want: [][3]int{{0, 2, 5}, {3, 5, 8}, {6, 8, 10}},
+		},
+		{name: "in sample takes the whole period", end: at(4), inSample: 4 * day, outOfSample: 2 * day},
+		{name: "in sample longer than the period", end: at(3), inSample: 4 * day, outOfSample: 2 * day},
+	}
+	for _, tt := range tests {
+		got := walkForwardWindows(start, tt.end, tt.inSample, tt.outOfSample)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d windows, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			if !got[i].InSampleFrom.Equal(at(w[0])) || !got[i].OutOfSampleFrom.Equal(at(w[1])) || !got[i].OutOfSampleTo.Equal(at(w[2])) {
+				t.Errorf("%s: window %d is %s - %s - %s, want days %v", tt.name, i,
+					got[i].InSampleFrom, got[i].OutOfSampleFrom, got[i].OutOfSampleTo, w)
+			}
+		}
+	}
+}
+
+func TestCandlesBetween(t *testing.T) {
+	start := time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC)
+	var candles []*investapi.HistoricCandle
+	for i := 0; i < 5; i++ {
+		candles = append(candles, &investapi.HistoricCandle{Time: timestamppb.New(start.Add(time.Duration(i) * time.Minute)), IsComplete: true})
+	}
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name      string
+		from, to  time.Time
+		wantFirst int
+		wantCount int
+	}{
+		{name: "half open range", from: at(1), to: at(3), wantFirst: 1, wantCount: 2},
+		{name: "from inside a candle", from: at(1).Add(time.Second), to: at(3), wantFirst: 2, wantCount: 1},
+		{name: "whole list", from: at(-10), to: at(10), wantFirst: 0, wantCount: 5},
+		{name: "empty range", from: at(2), to: at(2), wantCount: 0},
+		{name: "after the last candle", from: at(5), to: at(10), wantCount: 0},
+	}
+	for _, tt := range tests {
+		got := candlesBetween(candles, tt.from, tt.to)
+		if len(got) != tt.wantCount {
+			t.Errorf("%s: %d candles, want %d", tt.name, len(got), tt.wantCount)
+			continue
+		}
+		if len(got) > 0 && got[0] != candles[tt.wantFirst] {
+			t.Errorf("%s: first candle at %s, want %s", tt.name, got[0].GetTime().AsTime(), candles[tt.wantFirst].GetTime().AsTime())
+		}
+	}
+}
+
+func TestParametersStability(t *testing.T) {
+	ranges := []ParameterRange{{Name: "short_window"}, {Name: "long_window"}}
+	windows := []WalkForwardWindow{
+		{Other: map[string]int{"short_window": 5, "long_window": 20}},
+		{Other: map[string]int{"short_window": 7, "long_window": 20}},
+		{Other: map[string]int{"short_window": 9, "long_window": 20}},
+	}
+
+	tests := []struct {
+		min, max     int
+		mean, stdDev float64
+	}{
+		{min: 5, max: 9, mean: 7, stdDev: math.Sqrt(8.0 / 3)},
+		{min: 20, max: 20, mean: 20, stdDev: 0},
+	}
+	got := parametersStability(ranges, windows)
+	for i, tt := range tests {
+		s := got[i]
+		if s.Name != ranges[i].Name || s.Min != tt.min || s.Max != tt.max || !almostEqual(s.Mean, tt.mean) || !almostEqual(s.StdDev, tt.stdDev) {
+			t.Errorf("%s: min %d max %d mean %v std %v, want %d %d %v %v",
+				ranges[i].Name, s.Min, s.Max, s.Mean, s.StdDev, tt.min, tt.max, tt.mean, tt.stdDev)
+		}
+	}
+}
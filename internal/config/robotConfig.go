@@ -10,6 +10,9 @@ type RobotConfig struct {
 	AppName            string `yaml:"app_name"`
 	TinkoffAccessToken string `env:"TINKOFF_ACCESS_TOKEN"`
 	TinkoffApiEndpoint string `yaml:"tinkoff_api_endpoint"`
+
+	CancelOrdersOnShutdown bool `yaml:"cancel_orders_on_shutdown" env-default:"false"` // отменять активные заявки при остановке робота
+	ShutdownTimeout        int  `yaml:"shutdown_timeout" env-default:"60"`             // сколько секунд ждать остановки микро-роботов
 }
 
 // LoadRobotConfig Загружает конфигурацию робота из файла и переменных окружения
@@ -12,16 +12,43 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	MarketOrder = "market" // рыночная заявка, исполняется сразу по лучшей цене
+	LimitOrder  = "limit"  // лимитная заявка на вход по цене закрытия последней свечи
+)
+
+const (
+	StopLoss  = "stop_loss"  // при срабатывании стопа выставляется рыночная заявка
+	StopLimit = "stop_limit" // при срабатывании стопа выставляется лимитная заявка по стоп-цене
+)
+
 type StrategyConfig struct {
-	Name     string         `yaml:"name"`
-	Interval string         `yaml:"interval"`
-	Quantity int64          `yaml:"quantity"`
-	Other    map[string]int `yaml:"other"`
+	Name         string `yaml:"name"`
+	Interval     string `yaml:"interval"`
+	Quantity     int64  `yaml:"quantity"` // количество лотов в одной заявке
+	OrderType    string `yaml:"order_type" env-default:"market"`
+	OrderTimeout int    `yaml:"order_timeout"` // через сколько секунд отменять неисполненную лимитную заявку на вход
+
+	// Сигналы стратегии по умолчанию вычисляются на закрытых свечах, как в бэктесте.
+	// evaluate_on_tick включает вычисление на каждом обновлении формирующейся свечи
+	EvaluateOnTick bool `yaml:"evaluate_on_tick,omitempty"`
+
+	// Защитные стоп-заявки выставляются у брокера после каждого входа в позицию.
+	// Расстояние от цены входа задаётся в процентах или в ATR, нулевые значения отключают заявку
+	StopLossPercent   float64 `yaml:"stop_loss_percent,omitempty"`
+	StopLossAtr       float64 `yaml:"stop_loss_atr,omitempty"`
+	StopLossType      string  `yaml:"stop_loss_type,omitempty" env-default:"stop_loss"`
+	TakeProfitPercent float64 `yaml:"take_profit_percent,omitempty"`
+	TakeProfitAtr     float64 `yaml:"take_profit_atr,omitempty"`
+	AtrWindow         int     `yaml:"atr_window,omitempty"`
+
+	Other map[string]int `yaml:"other"`
 }
 
 type TradingConfig struct {
 	AccountId      string         `yaml:"account_id"`
 	IsSandbox      bool           `yaml:"is_sandbox"`
+	InstrumentType string         `yaml:"instrument_type" env-default:"share"` // share, etf, bond, futures или currency
 	Ticker         string         `yaml:"ticker"`
 	Figi           string         `yaml:"figi"`
 	Exchange       string         `yaml:"exchange"`
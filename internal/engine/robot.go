@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -9,6 +10,8 @@ import (
 
 	"tinkoff-invest-bot/internal/config"
 	"tinkoff-invest-bot/internal/strategy"
+	api "tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/archive"
 	"tinkoff-invest-bot/pkg/sdk"
 )
 
@@ -20,23 +23,29 @@ type investRobot struct {
 	logger          *zap.Logger
 	sdk             *sdk.SDK
 
-	restartDelay time.Duration
+	statusConsumer *sdk.TradingStatusConsumer
+	scheduler      *sessionScheduler
+
+	restartDelay time.Duration // задержка перед перезапуском после ошибки во время торговой сессии
 }
 
-// New создать новый инстанс микро-робота
-func New(conf *config.RobotConfig, tradingConfig *config.TradingConfig, s *sdk.SDK, logger *zap.Logger) (*investRobot, error) {
-	tradingStrategy, err := strategy.FromConfig(tradingConfig, s, logger)
+// New создать новый инстанс микро-робота, свечи для разогрева стратегии берутся из history, если они там есть
+func New(conf *config.RobotConfig, tradingConfig *config.TradingConfig, s *sdk.SDK, history *archive.Archive, logger *zap.Logger) (*investRobot, error) {
+	broker := sdk.NewBroker(s, tradingConfig.IsSandbox)
+	tradingStrategy, err := strategy.FromConfig(tradingConfig, s, broker, logger)
 	if err != nil {
 		return nil, err
 	}
 
 	// При старте микро-робота он сразу же загружает предыдущие свечки,
-	// чтобы моментально начать торговать
-	c, _, err := s.GetCandles(
+	// чтобы моментально начать торговать. Свечей загружается столько, сколько нужно стратегии для разогрева
+	c, err := loadWarmUpCandles(
+		s,
+		history,
 		tradingConfig.Figi,
-		time.Now().AddDate(0, 0, -1),
+		tradingConfig.StrategyConfig.Interval,
+		tradingStrategy.WarmUpPeriod(),
 		time.Now(),
-		sdk.IntervalToCandleInterval(tradingConfig.StrategyConfig.Interval),
 	)
 	if err != nil {
 		return nil, err
@@ -44,63 +53,183 @@ func New(conf *config.RobotConfig, tradingConfig *config.TradingConfig, s *sdk.S
 
 	tradingStrategy.Init(strategy.HistoricCandlesToTechanCandles(c, sdk.IntervalToDuration(tradingConfig.StrategyConfig.Interval)))
 	logger.Info(fmt.Sprintf("Initialization %s with %v candles", tradingConfig.Ticker, len(c)))
+	if len(c) < tradingStrategy.WarmUpPeriod() {
+		logger.Warn(
+			"Not enough candles for strategy warm-up",
+			zap.String("ticker", tradingConfig.Ticker),
+			zap.Int("candles", len(c)),
+			zap.Int("warmUpPeriod", tradingStrategy.WarmUpPeriod()),
+		)
+	}
 
-	return &investRobot{
+	robot := &investRobot{
 		robotConfig:     conf,
 		tradingConfig:   tradingConfig,
 		tradingStrategy: tradingStrategy,
 		logger:          logger,
 		sdk:             s,
+		scheduler:       newSessionScheduler(s, tradingConfig.Exchange),
 
 		restartDelay: 10 * time.Second,
-	}, nil
+	}
+	var statusConsumer sdk.TradingStatusConsumer = robot
+	robot.statusConsumer = &statusConsumer
+
+	return robot, nil
 }
 
-// Run запускает микро-робота,
-// микро-робот будет автоматически перезапускаться в случае ошибки
-func (r *investRobot) Run() {
+// ConsumeTradingStatus приостанавливает выставление ордеров, когда инструмент выходит из режима нормальной торговли
+// (аукционы, перерывы, остановка торгов) и возобновляет, когда нормальная торговля восстанавливается
+func (r *investRobot) ConsumeTradingStatus(status *api.TradingStatus) {
+	r.applyTradingStatus(status.GetTradingStatus(), status.GetMarketOrderAvailableFlag(), status.GetLimitOrderAvailableFlag())
+}
+
+// applyTradingStatus торговать можно при нормальной торговле, если биржа принимает заявки того типа,
+// который указан в трейдинг конфиге
+func (r *investRobot) applyTradingStatus(status api.SecurityTradingStatus, marketOrderAvailable bool, limitOrderAvailable bool) {
+	orderAvailable := marketOrderAvailable
+	if r.tradingConfig.StrategyConfig.OrderType == config.LimitOrder {
+		orderAvailable = limitOrderAvailable
+	}
+	canTrade := sdk.IsNormalTrading(status) && orderAvailable
+	if canTrade && r.tradingStrategy.IsPaused() {
+		r.tradingStrategy.Resume()
+		r.logger.Info(
+			"Micro-robot resumed trading",
+			zap.String("ticker", r.tradingConfig.Ticker),
+			zap.String("tradingStatus", status.String()),
+		)
+	} else if !canTrade && !r.tradingStrategy.IsPaused() {
+		r.tradingStrategy.Pause()
+		r.logger.Info(
+			"Micro-robot paused trading",
+			zap.String("ticker", r.tradingConfig.Ticker),
+			zap.String("tradingStatus", status.String()),
+			zap.Bool("marketOrderAvailable", marketOrderAvailable),
+			zap.Bool("limitOrderAvailable", limitOrderAvailable),
+		)
+	}
+}
+
+// Run запускает микро-робота. Микро-робот спит до открытия ближайшей торговой сессии,
+// торгует до её окончания и засыпает до следующей. В случае ошибки во время сессии он перезапускается.
+// Run возвращается после отмены ctx, когда стратегия остановлена, а ошибка описывает проблемы при остановке
+func (r *investRobot) Run(ctx context.Context) error {
+	var retryDelay time.Duration
 	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		session, ok, err := r.scheduler.NextSession(time.Now())
+		if err != nil {
+			retryDelay = nextRetryDelay(retryDelay)
+			r.logger.Info(
+				"Can't receive trading sessions",
+				zap.String("ticker", r.tradingConfig.Ticker),
+				zap.String("exchange", r.tradingConfig.Exchange),
+				zap.Duration("retryIn", retryDelay),
+				zap.Error(err),
+			)
+			sleep(ctx, retryDelay)
+			continue
+		}
+		retryDelay = 0
+
+		if !ok {
+			r.logger.Info(
+				"No trading sessions in schedule",
+				zap.String("ticker", r.tradingConfig.Ticker),
+				zap.String("exchange", r.tradingConfig.Exchange),
+			)
+			sleep(ctx, noSessionsRecheckDelay)
+			continue
+		}
+		if wait := time.Until(session.Start); wait > 0 {
+			r.logger.Info(
+				"Waiting for trading session",
+				zap.String("ticker", r.tradingConfig.Ticker),
+				zap.String("exchange", session.Exchange),
+				zap.Time("sessionStart", session.Start),
+				zap.Time("sessionEnd", session.End),
+			)
+			sleep(ctx, wait)
+			continue
+		}
+
 		r.logger.Info(
 			"Micro-robot started",
-			zap.String("ticker", r.tradingConfig.Figi),
+			zap.String("ticker", r.tradingConfig.Ticker),
+			zap.Time("sessionEnd", session.End),
 		)
-
-		if err := r.run(); err != nil {
+		err = r.run(ctx, session.End)
+		if ctx.Err() != nil { // робот остановлен снаружи, перезапуск не нужен
+			return err
+		}
+		if err != nil {
 			r.logger.Info(
 				"Micro-robot finished with error",
-				zap.String("ticker", r.tradingConfig.Figi),
+				zap.String("ticker", r.tradingConfig.Ticker),
 				zap.Error(err),
 			)
+			sleep(ctx, r.restartDelay)
 		} else {
 			r.logger.Info(
 				"Micro-robot finished successfully",
-				zap.String("ticker", r.tradingConfig.Figi),
+				zap.String("ticker", r.tradingConfig.Ticker),
 			)
 		}
-
-		time.Sleep(r.restartDelay)
 	}
 }
 
-func (r *investRobot) run() error {
-	canTrade, _, err := r.sdk.CanTradeNow(r.tradingConfig.Exchange)
+// run торгует до sessionEnd, до завершения работы стратегии или до отмены ctx
+func (r *investRobot) run(ctx context.Context, sessionEnd time.Time) error {
+	status, _, err := r.sdk.GetTradingStatus(r.tradingConfig.Figi)
 	if err != nil {
-		return xerrors.Errorf("can't receive trading schedules: %w", err)
+		return xerrors.Errorf("can't receive trading status: %w", err)
 	}
-	if !canTrade {
-		return xerrors.Errorf("instrument %s is not available, exchange is closed", r.tradingConfig.Ticker)
+	r.applyTradingStatus(status.GetTradingStatus(), status.GetMarketOrderAvailableFlag(), status.GetLimitOrderAvailableFlag())
+
+	if err = r.sdk.SubscribeInfo(r.tradingConfig.Figi, r.statusConsumer); err != nil {
+		return xerrors.Errorf("can't subscribe on trading status: %w", err)
 	}
+	defer func() {
+		if err := r.sdk.UnsubscribeInfo(r.tradingConfig.Figi, r.statusConsumer); err != nil {
+			r.logger.Info("Can't unsubscribe from trading status", zap.String("ticker", r.tradingConfig.Ticker), zap.Error(err))
+		}
+	}()
 
 	err = (*r.tradingStrategy).Start()
 	if err != nil {
+		stopErr := (*r.tradingStrategy).Stop() // отписываемся от того, на что успели подписаться
+		if stopErr != nil {
+			r.logger.Info("Can't stop robot trading strategy", zap.String("ticker", r.tradingConfig.Ticker), zap.Error(stopErr))
+		}
 		return xerrors.Errorf("can't start robot trading strategy, %v", err)
 	}
 
-	(*r.tradingStrategy).BlockUntilEnd()
+	(*r.tradingStrategy).BlockUntil(ctx, sessionEnd)
 
+	// Stop дожидается заявки, которая выставляется прямо сейчас, поэтому робот не прерывается посреди заявки
 	err = (*r.tradingStrategy).Stop()
 	if err != nil {
-		return xerrors.Errorf("can't stop robot trading strategy, %v", err)
+		err = xerrors.Errorf("can't stop robot trading strategy, %v", err)
+	}
+	if ctx.Err() != nil && r.robotConfig.CancelOrdersOnShutdown {
+		if cancelErr := (*r.tradingStrategy).CancelOpenOrders(); cancelErr != nil && err == nil {
+			err = xerrors.Errorf("can't cancel open orders: %w", cancelErr)
+		}
+	}
+	return err
+}
+
+// sleep ждёт d или отмены ctx
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
 	}
-	return nil
 }
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+const (
+	scheduleLookahead      = 7 * 24 * time.Hour // на сколько дней вперёд запрашивать расписание торгов
+	scheduleRefreshPeriod  = 12 * time.Hour     // как часто перечитывать расписание, даже если сессии в нём ещё есть
+	minScheduleRetryDelay  = 10 * time.Second
+	maxScheduleRetryDelay  = 10 * time.Minute
+	noSessionsRecheckDelay = 24 * time.Hour // если в расписании нет ни одной сессии, например во время длинных праздников
+)
+
+// sessionScheduler знает расписание торговых сессий площадки на несколько дней вперёд.
+// Расписание запрашивается редко, поэтому ожидание открытия биржи не нагружает API
+type sessionScheduler struct {
+	sdk      *sdk.SDK
+	exchange string
+
+	sessions    []sdk.TradingSession
+	refreshedAt time.Time
+}
+
+func newSessionScheduler(s *sdk.SDK, exchange string) *sessionScheduler {
+	return &sessionScheduler{
+		sdk:      s,
+		exchange: exchange,
+	}
+}
+
+// NextSession возвращает текущую сессию, если торги идут, или ближайшую будущую.
+// false означает, что в расписании на scheduleLookahead вперёд сессий нет
+func (s *sessionScheduler) NextSession(now time.Time) (sdk.TradingSession, bool, error) {
+	if session, ok := s.findSession(now); ok && now.Sub(s.refreshedAt) < scheduleRefreshPeriod {
+		return session, true, nil
+	}
+
+	if err := s.refresh(now); err != nil {
+		return sdk.TradingSession{}, false, err
+	}
+	session, ok := s.findSession(now)
+	return session, ok, nil
+}
+
+func (s *sessionScheduler) refresh(now time.Time) error {
+	// расписание запрашивается с начала суток, чтобы не потерять сессию, которая уже идёт
+	from := now.UTC().Truncate(24 * time.Hour)
+	sessions, _, err := s.sdk.GetTradingSessions(s.exchange, from, from.Add(scheduleLookahead))
+	if err != nil {
+		return xerrors.Errorf("can't receive trading schedules: %w", err)
+	}
+	s.sessions = sessions
+	s.refreshedAt = now
+	return nil
+}
+
+// findSession ищет первую сессию, которая ещё не закончилась. Пересекающиеся сессии разных площадок склеиваются
+func (s *sessionScheduler) findSession(now time.Time) (sdk.TradingSession, bool) {
+	for i, session := range s.sessions {
+		if !session.End.After(now) {
+			continue
+		}
+		for _, next := range s.sessions[i+1:] {
+			if next.Start.After(session.End) {
+				break
+			}
+			if next.End.After(session.End) {
+				session.End = next.End
+			}
+		}
+		return session, true
+	}
+	return sdk.TradingSession{}, false
+}
+
+// nextRetryDelay увеличивает задержку перед повторным запросом расписания вдвое, но не больше maxScheduleRetryDelay
+func nextRetryDelay(d time.Duration) time.Duration {
+	if d < minScheduleRetryDelay {
+		return minScheduleRetryDelay
+	}
+	d *= 2
+	if d > maxScheduleRetryDelay {
+		return maxScheduleRetryDelay
+	}
+	return d
+}
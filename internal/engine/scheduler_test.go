@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+var scheduleDay = time.Date(2022, 5, 4, 0, 0, 0, 0, time.UTC)
+
+// at время дня scheduleDay, hours может быть больше 24 для следующих дней
+func at(hours int, minutes int) time.Time {
+	return scheduleDay.Add(time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute)
+}
+
+func session(exchange string, start time.Time, end time.Time) sdk.TradingSession {
+	return sdk.TradingSession{Exchange: exchange, Start: start, End: end}
+}
+
+func TestFindSession(t *testing.T) {
+	sessions := []sdk.TradingSession{
+		session("MOEX", at(7, 0), at(15, 40)),
+		session("MOEX_EVENING", at(16, 0), at(20, 50)),
+		session("SPB", at(20, 0), at(23, 0)),       // пересекается с вечерней сессией
+		session("SPB_LATE", at(23, 0), at(25, 45)), // начинается сразу после предыдущей
+		session("MOEX", at(31, 0), at(39, 40)),
+	}
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		start, end time.Time
+		found      bool
+	}{
+		{name: "before the first session", now: at(6, 0), start: at(7, 0), end: at(15, 40), found: true},
+		{name: "during a session", now: at(10, 0), start: at(7, 0), end: at(15, 40), found: true},
+		{name: "at the end of a session", now: at(15, 40), start: at(16, 0), end: at(25, 45), found: true},
+		{name: "between sessions", now: at(15, 50), start: at(16, 0), end: at(25, 45), found: true},
+		{name: "during merged sessions", now: at(22, 0), start: at(20, 0), end: at(25, 45), found: true},
+		{name: "next day", now: at(26, 0), start: at(31, 0), end: at(39, 40), found: true},
+		{name: "after the last session", now: at(40, 0), found: false},
+	}
+	scheduler := &sessionScheduler{sessions: sessions}
+	for _, tt := range tests {
+		got, found := scheduler.findSession(tt.now)
+		if found != tt.found || !got.Start.Equal(tt.start) || !got.End.Equal(tt.end) {
+			t.Errorf("%s: session %s - %s (%v), want %s - %s (%v)", tt.name, got.Start, got.End, found, tt.start, tt.end, tt.found)
+		}
+	}
+}
+
+func TestNextSessionUsesFreshSchedule(t *testing.T) {
+	// без SDK расписание нельзя перечитать, поэтому сессия может прийти только из уже загруженного расписания
+	scheduler := &sessionScheduler{
+		sessions:    []sdk.TradingSession{session("MOEX", at(7, 0), at(15, 40))},
+		refreshedAt: at(1, 0),
+	}
+	got, found, err := scheduler.NextSession(at(12, 59))
+	if err != nil || !found || !got.Start.Equal(at(7, 0)) {
+		t.Errorf("NextSession = %v, %v, %v, want the loaded session", got, found, err)
+	}
+}
+
+func TestNextRetryDelay(t *testing.T) {
+	tests := []struct {
+		in, want time.Duration
+	}{
+		{in: 0, want: 10 * time.Second},
+		{in: 5 * time.Second, want: 10 * time.Second},
+		{in: 10 * time.Second, want: 20 * time.Second},
+		{in: 4 * time.Minute, want: 8 * time.Minute},
+		{in: 5 * time.Minute, want: 10 * time.Minute},
+		{in: 6 * time.Minute, want: 10 * time.Minute},
+		{in: 10 * time.Minute, want: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := nextRetryDelay(tt.in); got != tt.want {
+			t.Errorf("nextRetryDelay(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/archive"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// maxWarmUpLookback как далеко в прошлое можно уходить за свечами для разогрева,
+// чтобы не запрашивать историю бесконечно для нового или давно не торгующегося инструмента
+const maxWarmUpLookback = 30 * 24 * time.Hour
+
+// loadWarmUpCandles загружает не меньше need последних закрытых свечей, двигаясь назад по истории
+// отрезками, которые GetCandles отдаёт за один запрос. Отрезки, которые целиком есть в архиве history, читаются
+// из него, остальные через сервис истории. Выходные и праздники просто дают пустые отрезки.
+// Последняя незакрытая свеча тоже возвращается, стрим будет обновлять её на месте
+func loadWarmUpCandles(s *sdk.SDK, history *archive.Archive, figi string, interval string, need int, now time.Time) ([]*investapi.HistoricCandle, error) {
+	step := sdk.IntervalToMaxRequestPeriod(interval)
+
+	var candles []*investapi.HistoricCandle
+	complete := 0
+	for to := now; complete < need && now.Sub(to) < maxWarmUpLookback; to = to.Add(-step) {
+		c, err := loadCandles(s, history, figi, interval, to.Add(-step), to)
+		if err != nil {
+			return nil, xerrors.Errorf("can't receive candles: %w", err)
+		}
+		for _, candle := range c {
+			if candle.GetIsComplete() {
+				complete++
+			}
+		}
+		candles = append(c, candles...)
+	}
+	return candles, nil
+}
+
+// loadCandles берёт свечи из архива, если он целиком покрывает период, иначе загружает их через сервис истории
+func loadCandles(s *sdk.SDK, history *archive.Archive, figi string, interval string, from time.Time, to time.Time) ([]*investapi.HistoricCandle, error) {
+	if history != nil && history.Covers(figi, interval, from, to) {
+		return history.Candles(figi, interval, from, to)
+	}
+	return s.History().GetCandles(figi, from, to, sdk.IntervalToCandleInterval(interval))
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/archive"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+func TestLoadWarmUpCandles(t *testing.T) {
+	now := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	history, err := archive.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// торги по часу 9 и 10 мая с 10:00, в остальные дни свечей нет. Архив покрывает все 30 дней до now,
+	// поэтому сервис истории не нужен
+	var candles []*investapi.HistoricCandle
+	for _, day := range []time.Time{now.Add(-26 * time.Hour), now.Add(-2 * time.Hour)} {
+		for i := 0; i < 60; i++ {
+			candles = append(candles, &investapi.HistoricCandle{
+				Time:       timestamppb.New(day.Add(time.Duration(i) * time.Minute)),
+				Open:       sdk.DecimalToQuotation(decimal.NewFromInt(100)),
+				High:       sdk.DecimalToQuotation(decimal.NewFromInt(100)),
+				Low:        sdk.DecimalToQuotation(decimal.NewFromInt(100)),
+				Close:      sdk.DecimalToQuotation(decimal.NewFromInt(100)),
+				IsComplete: true,
+			})
+		}
+	}
+	instrument := &sdk.InstrumentInfo{Figi: "FIGI", Lot: 1, MinPriceIncrement: decimal.RequireFromString("0.01")}
+	if err = history.Write(instrument, "1_MIN", now.Add(-maxWarmUpLookback), now, candles); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		need        int
+		count       int
+		first, last time.Time
+	}{
+		// первый отрезок [9 мая 12:00, 10 мая 12:00) содержит только свечи 10 мая
+		{name: "one request period", need: 60, count: 60, first: now.Add(-2 * time.Hour), last: now.Add(-61 * time.Minute)},
+		{name: "two request periods", need: 61, count: 120, first: now.Add(-26 * time.Hour), last: now.Add(-61 * time.Minute)},
+		// свечей меньше, чем нужно, поиск останавливается на maxWarmUpLookback
+		{name: "not enough history", need: 200, count: 120, first: now.Add(-26 * time.Hour), last: now.Add(-61 * time.Minute)},
+	}
+	for _, tt := range tests {
+		got, err := loadWarmUpCandles(nil, history, "FIGI", "1_MIN", tt.need, now)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(got) != tt.count {
+			t.Errorf("%s: %d candles, want %d", tt.name, len(got), tt.count)
+			continue
+		}
+		if first, last := got[0].GetTime().AsTime(), got[len(got)-1].GetTime().AsTime(); !first.Equal(tt.first) || !last.Equal(tt.last) {
+			t.Errorf("%s: candles from %s to %s, want from %s to %s", tt.name, first, last, tt.first, tt.last)
+		}
+	}
+}
@@ -32,3 +32,25 @@ var (
 		"simpleAroon": {window},
 	}
 )
+
+// IsValidParameters подходят ли параметры стратегии: окна положительные,
+// а короткое окно меньше среднего, среднее меньше длинного
+func IsValidParameters(other map[string]int) bool {
+	for _, value := range other {
+		if value <= 0 {
+			return false
+		}
+	}
+	windows := []int{other[shortWindow], other[middleWindow], other[longWindow]}
+	prev := 0
+	for _, w := range windows {
+		if w == 0 { // окна нет у стратегии
+			continue
+		}
+		if w <= prev {
+			return false
+		}
+		prev = w
+	}
+	return true
+}
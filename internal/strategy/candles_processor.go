@@ -1,7 +1,11 @@
 package strategy
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/iamjinlei/go-tachart/tachart"
 	"github.com/sdcoffey/big"
@@ -9,65 +13,119 @@ import (
 	"go.uber.org/zap"
 
 	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/internal/rule-strategy"
 	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
 	"tinkoff-invest-bot/pkg/sdk"
 )
 
 const (
 	graphDirName string = "./graphs/"
-)
 
-type FinishEvent struct{}
+	tapeCapacity     int     = 1000  // сколько последних обезличенных сделок хранить в ленте
+	maxFillDeviation float64 = 0.005 // допустимое отклонение цены исполнения от цены в ленте сделок
+	defaultAtrWindow int     = 14    // окно ATR для защитных стоп-заявок, если в конфиге не указано
+)
 
 // CandlesStrategyProcessor запускалка всех стратегий, работа которых основана на свечках
 type CandlesStrategyProcessor struct {
 	tradingConfig *config.TradingConfig
 	sdk           *sdk.SDK
+	broker        sdk.Broker
+	instrument    *sdk.InstrumentInfo
 	logger        *zap.Logger
 
-	timeSeries    *techan.TimeSeries
-	TradingRecord *techan.TradingRecord
-	ruleStrategy  *techan.RuleStrategy
+	timeSeries          *techan.TimeSeries
+	TradingRecord       *techan.TradingRecord
+	ruleStrategy        *techan.RuleStrategy
+	ruleStrategyFactory rule_strategy.RuleStrategy
+	indicatorsStale     bool // последняя свеча обновлялась после того, как по ней считались индикаторы
+
+	recordMu *sync.Mutex // защищает свечи, события и историю трейдинга, они обновляются из стрима свечей и стрима исполнения заявок
+	candles  []tachart.Candle
+	events   []tachart.Event
+
+	candlesConsumer *sdk.MarketDataConsumer
+	tape            *sdk.TradesTape
+	tapeConsumer    *sdk.TradesConsumer
+
+	paused *int32 // выставление ордеров приостановлено, если инструмент вышел из режима нормальной торговли
+
+	protectiveStops []string        // идентификаторы защитных стоп-заявок по открытой позиции
+	lastStopsCheck  time.Time       // когда последний раз проверялось, не сработали ли стоп-заявки
+	entryPrice      decimal.Decimal // точная цена входа в открытую позицию, в истории трейдинга цена хранится приближённо
+	lastClose       decimal.Decimal // точная цена закрытия последней свечи из стрима, по ней выставляются лимитные заявки
 
-	candles []tachart.Candle
-	events  []tachart.Event
+	fillsConsumer *sdk.OrderTradesConsumer
+	fillsStream   bool                     // история трейдинга ведётся по стриму исполнения заявок
+	orderFills    map[string]*trackedOrder // исполнение заявок по идентификатору заявки на бирже
 
-	blockChannel chan FinishEvent
+	lifecycleMu *sync.Mutex     // защищает stopped и добавление в inFlight
+	stopped     bool            // стратегия остановлена, новые свечи не обрабатываются
+	stopping    chan struct{}   // закрывается в Stop, чтобы ожидание заявки не задерживало остановку
+	inFlight    *sync.WaitGroup // обработка свечи, которая может выставлять заявку прямо сейчас
+}
+
+// WarmUpPeriod сколько закрытых свечей нужно загрузить до начала торговли, чтобы стратегия сразу давала сигналы:
+// стратегия нестабильна первые UnstablePeriod свечей, а правилам пересечения нужна ещё одна предыдущая свеча
+func (w *CandlesStrategyProcessor) WarmUpPeriod() int {
+	period := w.ruleStrategy.UnstablePeriod
+	if c := w.tradingConfig.StrategyConfig; c.StopLossAtr > 0 || c.TakeProfitAtr > 0 {
+		atrWindow := c.AtrWindow
+		if atrWindow <= 0 {
+			atrWindow = defaultAtrWindow
+		}
+		if atrWindow > period {
+			period = atrWindow
+		}
+	}
+	return period + 1
 }
 
+// Init загружает исторические свечи перед началом торговли. Последняя свеча может быть ещё не сформирована,
+// тогда её обновления из стрима заменят её на месте
 func (w *CandlesStrategyProcessor) Init(candles []*techan.Candle) {
+	w.recordMu.Lock()
+	defer w.recordMu.Unlock()
+
 	for _, candle := range candles {
-		if w.timeSeries.AddCandle(candle) {
-			w.candles = append(w.candles, tachart.Candle{
-				Label: candle.Period.Start.Format("02.01/15:04"),
-				O:     candle.OpenPrice.Float(),
-				H:     candle.MaxPrice.Float(),
-				L:     candle.MinPrice.Float(),
-				C:     candle.ClosePrice.Float(),
-				V:     candle.Volume.Float(),
-			})
-		}
+		w.putCandle(candle, false)
 	}
 }
 
-// GenGraph генерирует график в .html и ложит его в директорию с графиками
-func (w CandlesStrategyProcessor) GenGraph(dirname string, filename string) {
+// GenGraph генерирует график в .html и ложит его в директорию с графиками.
+// Индикаторы, например кривая стоимости счёта в бэктесте, рисуются под свечами, по значению на свечу
+func (w CandlesStrategyProcessor) GenGraph(dirname string, filename string, indicators ...tachart.Indicator) {
 	err := config.CreateDirIfNotExist(dirname)
 	if err != nil {
 		w.logger.Info("Can't create dir")
 	}
 	cfg := tachart.NewConfig().
 		SetChartWidth(1400).
-		SetChartHeight(800).AddOverlay(tachart.NewEMA(100))
+		SetChartHeight(800).AddOverlay(tachart.NewEMA(100)).
+		AddIndicator(indicators...)
+
+	// последняя свеча обновляется на месте, поэтому график строится по копии
+	w.recordMu.Lock()
+	candles := append([]tachart.Candle(nil), w.candles...)
+	events := append([]tachart.Event(nil), w.events...)
+	w.recordMu.Unlock()
 
 	c := tachart.New(*cfg)
-	err = c.GenStatic(w.candles, w.events, dirname+filename)
+	err = c.GenStatic(candles, events, dirname+filename)
 	if err != nil {
 		w.logger.Info("Can't gen graph")
 	}
 }
 
-func (w *CandlesStrategyProcessor) AddEvent(op Operation, orderId string, executedPrice float64, totalAmount float64) {
+// AddEvent добавляет в историю трейдинга исполненную заявку: цена за 1 инструмент и количество лотов
+func (w *CandlesStrategyProcessor) AddEvent(op Operation, orderId string, executedPrice decimal.Decimal, lots int64) {
+	w.recordMu.Lock()
+	defer w.recordMu.Unlock()
+	w.addEvent(op, orderId, executedPrice, lots)
+}
+
+func (w *CandlesStrategyProcessor) addEvent(op Operation, orderId string, executedPrice decimal.Decimal, lots int64) {
 	var eventType tachart.EventType
 	switch op {
 	case Buy:
@@ -84,27 +142,100 @@ func (w *CandlesStrategyProcessor) AddEvent(op Operation, orderId string, execut
 	w.TradingRecord.Operate(techan.Order{
 		Side:          techan.OrderSide(op),
 		Security:      orderId,
-		Price:         big.NewDecimal(executedPrice),
-		Amount:        big.NewDecimal(totalAmount),
+		Price:         executedPrice.Big(),
+		Amount:        big.NewFromInt(int(lots)),
 		ExecutionTime: w.timeSeries.LastCandle().Period.End,
 	})
+	if op == Buy {
+		w.entryPrice = executedPrice
+	}
 }
 
+// Step добавляет уже сформированную свечу (например, историческую) и вычисляет на ней сигнал стратегии.
+// Свеча того же периода, что и последняя, заменяет её
 func (w *CandlesStrategyProcessor) Step(candle *techan.Candle, drawGraph bool) Operation {
-	if w.timeSeries.AddCandle(candle) {
-		w.candles = append(w.candles, tachart.Candle{
-			Label: candle.Period.Start.Format("02.01/15:04"),
-			O:     candle.OpenPrice.Float(),
-			H:     candle.MaxPrice.Float(),
-			L:     candle.MinPrice.Float(),
-			C:     candle.ClosePrice.Float(),
-			V:     candle.Volume.Float(),
-		})
-		fmt.Printf("Added candle %v for %s: %f\n", w.timeSeries.LastIndex(), w.tradingConfig.Ticker, candle.ClosePrice.Float())
-		if drawGraph {
-			go w.GenGraph(graphDirName, w.tradingConfig.Ticker+"_"+w.tradingConfig.AccountId+".html")
+	w.recordMu.Lock()
+	defer w.recordMu.Unlock()
+
+	if w.putCandle(candle, drawGraph) { // исторических свечей бывают сотни тысяч, поэтому только в debug
+		w.logger.Debug(
+			"Added candle",
+			zap.Int("index", w.timeSeries.LastIndex()),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.Float64("close", candle.ClosePrice.Float()),
+		)
+	}
+	return w.evaluate()
+}
+
+// Tick обрабатывает свечу из стрима. Пока свеча формируется, стрим присылает её много раз,
+// последняя свеча при этом обновляется на месте. Сигнал вычисляется на закрытой свече, то есть когда пришла
+// свеча следующего периода, поэтому торговля видит те же бары, что и бэктест.
+// Если в конфиге указано evaluate_on_tick, сигнал вычисляется на каждом обновлении
+func (w *CandlesStrategyProcessor) Tick(candle *techan.Candle, drawGraph bool) Operation {
+	w.recordMu.Lock()
+	defer w.recordMu.Unlock()
+
+	evaluateOnTick := w.tradingConfig.StrategyConfig.EvaluateOnTick
+	last := w.timeSeries.LastCandle()
+	switch {
+	case last != nil && candle.Period.Start.Before(last.Period.Start): // запоздавшее обновление уже закрытой свечи
+		return Hold
+	case last != nil && candle.Period.Start.Equal(last.Period.Start):
+		w.putCandle(candle, false)
+		if !evaluateOnTick {
+			return Hold
 		}
-	} // добавляем пришедшую свечу (неважно откуда)
+		return w.evaluate()
+	}
+
+	op := Hold
+	if last != nil && !evaluateOnTick { // пришла свеча следующего периода, значит последняя свеча закрылась
+		op = w.evaluate()
+	}
+	if w.putCandle(candle, drawGraph) {
+		fmt.Printf("Added candle %v for %s: %f\n", w.timeSeries.LastIndex(), w.tradingConfig.Ticker, candle.ClosePrice.Float())
+	}
+	if evaluateOnTick {
+		op = w.evaluate()
+	}
+	return op
+}
+
+// putCandle вызывается под recordMu. Добавляет свечу нового периода или заменяет последнюю свечу того же периода,
+// true если была добавлена новая свеча
+func (w *CandlesStrategyProcessor) putCandle(candle *techan.Candle, drawGraph bool) bool {
+	chartCandle := tachart.Candle{
+		Label: candle.Period.Start.Format("02.01/15:04"),
+		O:     candle.OpenPrice.Float(),
+		H:     candle.MaxPrice.Float(),
+		L:     candle.MinPrice.Float(),
+		C:     candle.ClosePrice.Float(),
+		V:     candle.Volume.Float(),
+	}
+
+	if last := w.timeSeries.LastCandle(); last != nil && candle.Period.Start.Equal(last.Period.Start) {
+		w.timeSeries.Candles[w.timeSeries.LastIndex()] = candle
+		w.candles[len(w.candles)-1] = chartCandle
+		w.indicatorsStale = true
+		return false
+	}
+
+	if !w.timeSeries.AddCandle(candle) {
+		return false
+	}
+	w.candles = append(w.candles, chartCandle)
+	if drawGraph {
+		go w.GenGraph(graphDirName, w.tradingConfig.Ticker+"_"+w.tradingConfig.AccountId+".html")
+	}
+	return true
+}
+
+// evaluate вызывается под recordMu, вычисляет сигнал стратегии на последней свече
+func (w *CandlesStrategyProcessor) evaluate() Operation {
+	if w.indicatorsStale {
+		w.resetIndicators()
+	}
 
 	if w.ruleStrategy.ShouldEnter(w.timeSeries.LastIndex(), w.TradingRecord) {
 		return Buy
@@ -115,9 +246,28 @@ func (w *CandlesStrategyProcessor) Step(candle *techan.Candle, drawGraph bool) O
 	}
 }
 
+// resetIndicators пересоздаёт стратегию на тех же свечах. Индикаторы techan кэшируют посчитанные значения,
+// поэтому после обновления свечи на месте значения, посчитанные по незакрытой свече, нужно сбросить
+func (w *CandlesStrategyProcessor) resetIndicators() {
+	ruleStrategy, timeSeries := w.ruleStrategyFactory(*w.tradingConfig)
+	timeSeries.Candles = w.timeSeries.Candles
+	w.timeSeries = timeSeries
+	w.ruleStrategy = &ruleStrategy
+	w.indicatorsStale = false
+}
+
 // Consume будет вызван для каждой новой свечки, которая соответствует figi в трейдинг конфиге
-func (w CandlesStrategyProcessor) Consume(data *investapi.MarketDataResponse) {
-	op := w.Step(
+func (w *CandlesStrategyProcessor) Consume(data *investapi.MarketDataResponse) {
+	if !w.beginConsume() { // после Stop в очереди ещё могут остаться свечи
+		return
+	}
+	defer w.inFlight.Done()
+
+	// позиция могла быть закрыта стоп-заявкой у брокера, тогда стратегия должна узнать об этом до вычисления сигнала
+	w.reconcileProtectiveStops()
+
+	w.lastClose = sdk.QuotationToDecimal(data.GetCandle().GetClose())
+	op := w.Tick(
 		CandleToTechanCandle(
 			data.GetCandle(),
 			sdk.IntervalToDuration(w.tradingConfig.StrategyConfig.Interval),
@@ -125,11 +275,22 @@ func (w CandlesStrategyProcessor) Consume(data *investapi.MarketDataResponse) {
 		true,
 	)
 
+	if op != Hold && w.IsPaused() {
+		w.logger.Info(
+			"Order skipped because trading is paused",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("figi", w.tradingConfig.Figi),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.String("ruleStrategy", w.tradingConfig.StrategyConfig.Name),
+		)
+		return
+	}
+
 	switch op {
 	case Buy:
 		isEnough, trackingId, err := w.sdk.IsEnoughMoneyToBuy(
+			w.broker,
 			w.tradingConfig.AccountId,
-			w.tradingConfig.IsSandbox,
 			w.tradingConfig.Figi,
 			w.tradingConfig.Currency,
 			w.tradingConfig.StrategyConfig.Quantity,
@@ -160,12 +321,13 @@ func (w CandlesStrategyProcessor) Consume(data *investapi.MarketDataResponse) {
 		}
 
 	case Sell:
-		isAvailable, trackingId, err := w.sdk.IsEnoughMoneyToBuy(
+		// вход мог исполниться частично, поэтому продаётся столько лотов, сколько куплено
+		lots := w.openLots()
+		isAvailable, trackingId, err := w.sdk.IsAvailableForSale(
+			w.broker,
 			w.tradingConfig.AccountId,
-			w.tradingConfig.IsSandbox,
 			w.tradingConfig.Figi,
-			w.tradingConfig.Currency,
-			w.tradingConfig.StrategyConfig.Quantity,
+			lots,
 		)
 		if err != nil {
 			w.logger.Info(
@@ -179,8 +341,8 @@ func (w CandlesStrategyProcessor) Consume(data *investapi.MarketDataResponse) {
 			)
 		}
 
-		if isAvailable {
-			w.sell()
+		if isAvailable && lots > 0 {
+			w.sell(lots)
 		} else {
 			w.logger.Info(
 				"Can't sell share because not enough quantity of shares",
@@ -196,116 +358,199 @@ func (w CandlesStrategyProcessor) Consume(data *investapi.MarketDataResponse) {
 	}
 }
 
-func (w CandlesStrategyProcessor) buy() {
+func (w *CandlesStrategyProcessor) buy() {
 	orderId := sdk.GenerateOrderId()
 
-	var resp *investapi.PostOrderResponse
-	var trackingId string
-	var err error
-
-	if w.tradingConfig.IsSandbox {
-		resp, trackingId, err = w.sdk.SandboxMarketBuy(
-			w.tradingConfig.Figi,
-			w.tradingConfig.StrategyConfig.Quantity,
-			w.tradingConfig.AccountId,
-			orderId,
-		)
-	} else {
-		resp, trackingId, err = w.sdk.RealMarketBuy(
-			w.tradingConfig.Figi,
-			w.tradingConfig.StrategyConfig.Quantity,
-			w.tradingConfig.AccountId,
-			orderId,
-		)
-	}
-
+	resp, trackingId, err := w.postOrder(Buy, w.tradingConfig.StrategyConfig.Quantity, orderId)
 	if err != nil {
 		w.logger.Info(
 			"Can't Buy share",
 			zap.String("accountId", w.tradingConfig.AccountId),
 			zap.String("figi", w.tradingConfig.Figi),
 			zap.String("ticker", w.tradingConfig.Ticker),
-			zap.Float64("price", sdk.MoneyValueToFloat(resp.GetExecutedOrderPrice())),
 			zap.String("ruleStrategy", w.tradingConfig.StrategyConfig.Name),
 			zap.String("orderId", orderId),
 			zap.String("trackingId", trackingId),
 			zap.Error(err),
 		)
-	} else {
-		w.AddEvent(Buy, orderId, sdk.MoneyValueToFloat(resp.GetExecutedOrderPrice()), sdk.MoneyValueToFloat(resp.GetTotalOrderAmount()))
+		return
+	}
+	w.trackOrder(resp, Buy, orderId)
 
+	fill, err := w.awaitOrder(resp)
+	if err != nil {
 		w.logger.Info(
-			"Buy new share",
+			"Can't receive buy order state",
 			zap.String("accountId", w.tradingConfig.AccountId),
 			zap.String("figi", w.tradingConfig.Figi),
 			zap.String("ticker", w.tradingConfig.Ticker),
-			zap.Float64("price", sdk.MoneyValueToFloat(resp.GetExecutedOrderPrice())),
 			zap.String("ruleStrategy", w.tradingConfig.StrategyConfig.Name),
 			zap.String("orderId", orderId),
-			zap.String("trackingId", trackingId),
+			zap.Error(err),
 		)
+		return
+	}
+	if fill.lotsExecuted == 0 {
+		w.logger.Info(
+			"Buy order was not executed",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("figi", w.tradingConfig.Figi),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.String("ruleStrategy", w.tradingConfig.StrategyConfig.Name),
+			zap.String("orderId", orderId),
+			zap.String("status", fill.status.String()),
+		)
+		return
 	}
-}
 
-func (w CandlesStrategyProcessor) sell() {
-	orderId := sdk.GenerateOrderId()
+	if !w.fillsStream {
+		w.AddEvent(Buy, orderId, fill.averagePrice(), fill.lotsExecuted)
+	}
+	w.checkFillPrice(orderId, fill.averagePrice())
+	w.placeProtectiveStops(fill.averagePrice(), fill.lotsExecuted)
 
-	var resp *investapi.PostOrderResponse
-	var trackingId string
-	var err error
+	w.logger.Info(
+		"Buy new share",
+		zap.String("accountId", w.tradingConfig.AccountId),
+		zap.String("figi", w.tradingConfig.Figi),
+		zap.String("ticker", w.tradingConfig.Ticker),
+		zap.Stringer("price", fill.executedPrice),
+		zap.Int64("lots", fill.lotsExecuted),
+		zap.String("ruleStrategy", w.tradingConfig.StrategyConfig.Name),
+		zap.String("orderId", orderId),
+		zap.String("trackingId", trackingId),
+	)
+}
 
-	if w.tradingConfig.IsSandbox {
-		resp, trackingId, err = w.sdk.SandboxMarketSell(
-			w.tradingConfig.Figi,
-			w.tradingConfig.StrategyConfig.Quantity,
-			w.tradingConfig.AccountId,
-			orderId,
-		)
-	} else {
-		resp, trackingId, err = w.sdk.RealMarketSell(
-			w.tradingConfig.Figi,
-			w.tradingConfig.StrategyConfig.Quantity,
-			w.tradingConfig.AccountId,
-			orderId,
-		)
-	}
+// sell выходит из открытой позиции размером lots лотов
+func (w *CandlesStrategyProcessor) sell(lots int64) {
+	orderId := sdk.GenerateOrderId()
+	entrancePrice := w.entrancePrice()
 
+	resp, trackingId, err := w.postOrder(Sell, lots, orderId)
 	if err != nil {
 		w.logger.Info(
 			"Can't sell new share",
 			zap.String("accountId", w.tradingConfig.AccountId),
 			zap.String("figi", w.tradingConfig.Figi),
 			zap.String("ticker", w.tradingConfig.Ticker),
-			zap.Float64("price", sdk.MoneyValueToFloat(resp.GetExecutedOrderPrice())),
 			zap.String("ruleStrategy", w.tradingConfig.StrategyConfig.Name),
 			zap.String("orderId", orderId),
 			zap.String("trackingId", trackingId),
 			zap.Error(err),
 		)
-	} else {
-		w.AddEvent(Sell, orderId, sdk.MoneyValueToFloat(resp.GetExecutedOrderPrice()), sdk.MoneyValueToFloat(resp.GetTotalOrderAmount()))
+		return
+	}
+	w.trackOrder(resp, Sell, orderId)
 
+	fill, err := w.awaitOrder(resp)
+	if err != nil {
 		w.logger.Info(
-			"Sell share",
+			"Can't receive sell order state",
 			zap.String("accountId", w.tradingConfig.AccountId),
 			zap.String("figi", w.tradingConfig.Figi),
 			zap.String("ticker", w.tradingConfig.Ticker),
-			zap.Float64("price", sdk.MoneyValueToFloat(resp.GetExecutedOrderPrice())),
-			zap.Float64("income", w.TradingRecord.LastTrade().ExitOrder().Amount.Sub(w.TradingRecord.LastTrade().EntranceOrder().Amount).Float()),
 			zap.String("ruleStrategy", w.tradingConfig.StrategyConfig.Name),
 			zap.String("orderId", orderId),
-			zap.String("trackingId", trackingId),
+			zap.Error(err),
 		)
-		// w.blockChannel <- FinishEvent{}
+		return
 	}
+	if fill.lotsExecuted == 0 {
+		w.logger.Info(
+			"Sell order was not executed",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("figi", w.tradingConfig.Figi),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.String("ruleStrategy", w.tradingConfig.StrategyConfig.Name),
+			zap.String("orderId", orderId),
+			zap.String("status", fill.status.String()),
+		)
+		return
+	}
+
+	if !w.fillsStream {
+		w.AddEvent(Sell, orderId, fill.averagePrice(), fill.lotsExecuted)
+	}
+	w.checkFillPrice(orderId, fill.averagePrice())
+
+	// стоп-заявки снимаются только после исполнения выхода, до этого позиция должна оставаться защищённой.
+	// Если выход исполнился частично, оставшиеся лоты защищаются заново
+	w.cancelProtectiveStops()
+	if remaining := lots - fill.lotsExecuted; remaining > 0 {
+		w.placeProtectiveStops(entrancePrice, remaining)
+	}
+
+	w.logger.Info(
+		"Sell share",
+		zap.String("accountId", w.tradingConfig.AccountId),
+		zap.String("figi", w.tradingConfig.Figi),
+		zap.String("ticker", w.tradingConfig.Ticker),
+		zap.Stringer("price", fill.executedPrice),
+		zap.Int64("lots", fill.lotsExecuted),
+		zap.Stringer("income", fill.averagePrice().Sub(entrancePrice).MulInt(w.instrument.LotsToUnits(fill.lotsExecuted))),
+		zap.String("ruleStrategy", w.tradingConfig.StrategyConfig.Name),
+		zap.String("orderId", orderId),
+		zap.String("trackingId", trackingId),
+	)
 }
 
-func (w CandlesStrategyProcessor) Start() error {
-	var cons sdk.MarketDataConsumer = w
-	err := w.sdk.SubscribeCandles(w.tradingConfig.Figi, sdk.IntervalToSubscriptionInterval(w.tradingConfig.StrategyConfig.Interval), &cons)
+// entrancePrice цена входа в открытую позицию, 0 если позиция не открыта
+func (w *CandlesStrategyProcessor) entrancePrice() decimal.Decimal {
+	w.recordMu.Lock()
+	defer w.recordMu.Unlock()
+
+	if position := w.TradingRecord.CurrentPosition(); position.IsOpen() {
+		return w.entryPrice
+	}
+	return decimal.Zero
+}
+
+// checkFillPrice сверяет цену исполнения ордера с последней ценой в ленте обезличенных сделок
+func (w *CandlesStrategyProcessor) checkFillPrice(orderId string, executedPrice decimal.Decimal) {
+	tapePrice, ok := w.tape.LastPrice()
+	if !ok || tapePrice.IsZero() {
+		return
+	}
+	if executedPrice.Sub(tapePrice).Abs().Div(tapePrice).Float() > maxFillDeviation {
+		w.logger.Warn(
+			"Executed price differs from trades tape",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("figi", w.tradingConfig.Figi),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.Stringer("price", executedPrice),
+			zap.Stringer("tapePrice", tapePrice),
+			zap.String("orderId", orderId),
+		)
+	}
+}
+
+// Start подписывает стратегию на свечи, ленту сделок и исполнение заявок
+func (w *CandlesStrategyProcessor) Start() error {
+	w.lifecycleMu.Lock()
+	w.stopped = false
+	w.stopping = make(chan struct{})
+	w.lifecycleMu.Unlock()
+
+	err := w.sdk.SubscribeCandles(w.tradingConfig.Figi, sdk.IntervalToSubscriptionInterval(w.tradingConfig.StrategyConfig.Interval), w.candlesConsumer)
 	if err != nil {
 		return err
 	}
+	if err = w.sdk.SubscribeTrades(w.tradingConfig.Figi, w.tapeConsumer); err != nil {
+		return err
+	}
+
+	// если брокер не умеет присылать исполнение заявок, история трейдинга ведётся по ответам на выставление заявок
+	err = w.broker.SubscribeOrderTrades(w.tradingConfig.AccountId, w.tradingConfig.Figi, w.fillsConsumer)
+	w.fillsStream = err == nil
+	if err != nil {
+		w.logger.Info(
+			"Order trades stream is unavailable, using order responses",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("figi", w.tradingConfig.Figi),
+			zap.Error(err),
+		)
+	}
 
 	w.logger.Info(
 		"Algorithm started",
@@ -316,10 +561,38 @@ func (w CandlesStrategyProcessor) Start() error {
 	return nil
 }
 
-func (w CandlesStrategyProcessor) Stop() error {
-	var cons sdk.MarketDataConsumer = w
-	if err := w.sdk.UnsubscribeCandles(w.tradingConfig.Figi, &cons); err != nil {
-		return err
+// Stop останавливает стратегию: новые свечи больше не обрабатываются, неисполненная заявка, которая выставляется
+// прямо сейчас, отменяется с учётом исполненной части, после этого стратегия отписывается от всех стримов.
+// Отписка продолжается даже после ошибки, возвращается первая ошибка
+func (w *CandlesStrategyProcessor) Stop() error {
+	w.lifecycleMu.Lock()
+	if !w.stopped && w.stopping != nil {
+		close(w.stopping)
+	}
+	w.stopped = true
+	w.lifecycleMu.Unlock()
+
+	var firstErr error
+	interval := sdk.IntervalToSubscriptionInterval(w.tradingConfig.StrategyConfig.Interval)
+	if err := w.sdk.UnsubscribeCandles(w.tradingConfig.Figi, interval, w.candlesConsumer); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if err := w.sdk.UnsubscribeTrades(w.tradingConfig.Figi, w.tapeConsumer); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	// исполнение текущей заявки ещё может прийти по стриму, поэтому от него отписываемся последним
+	w.inFlight.Wait()
+
+	if w.fillsStream {
+		err := w.broker.UnsubscribeOrderTrades(w.tradingConfig.AccountId, w.tradingConfig.Figi, w.fillsConsumer)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		w.fillsStream = false
+	}
+	if firstErr != nil {
+		return firstErr
 	}
 	w.logger.Info(
 		"Algorithm stopped",
@@ -329,6 +602,47 @@ func (w CandlesStrategyProcessor) Stop() error {
 	return nil
 }
 
-func (w *CandlesStrategyProcessor) BlockUntilEnd() {
-	<-w.blockChannel
+// Pause приостанавливает выставление ордеров, сигналы стратегии при этом продолжают считаться
+func (w *CandlesStrategyProcessor) Pause() {
+	atomic.StoreInt32(w.paused, 1)
+}
+
+// Resume возобновляет выставление ордеров
+func (w *CandlesStrategyProcessor) Resume() {
+	atomic.StoreInt32(w.paused, 0)
+}
+
+// IsPaused приостановлено ли выставление ордеров
+func (w *CandlesStrategyProcessor) IsPaused() bool {
+	return atomic.LoadInt32(w.paused) == 1
+}
+
+// BlockUntil блокирует выполнение до отмены ctx или до наступления deadline, например конца торговой сессии
+func (w *CandlesStrategyProcessor) BlockUntil(ctx context.Context, deadline time.Time) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// stoppingSignal канал, который закроется при остановке стратегии
+func (w *CandlesStrategyProcessor) stoppingSignal() <-chan struct{} {
+	w.lifecycleMu.Lock()
+	defer w.lifecycleMu.Unlock()
+	return w.stopping
+}
+
+// beginConsume отмечает начало обработки свечи, false если стратегия уже остановлена
+func (w *CandlesStrategyProcessor) beginConsume() bool {
+	w.lifecycleMu.Lock()
+	defer w.lifecycleMu.Unlock()
+
+	if w.stopped {
+		return false
+	}
+	w.inFlight.Add(1)
+	return true
 }
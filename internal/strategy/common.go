@@ -1,6 +1,8 @@
 package strategy
 
 import (
+	"sync"
+
 	"github.com/iamjinlei/go-tachart/tachart"
 	"github.com/sdcoffey/techan"
 	"go.uber.org/zap"
@@ -19,26 +21,62 @@ const (
 	Hold
 )
 
-// FromConfig создаёт CandlesStrategyProcessor по трейдинг конфигу
-func FromConfig(tradingConfig *config.TradingConfig, s *sdk.SDK, logger *zap.Logger) (*CandlesStrategyProcessor, error) {
+// FromConfig создаёт CandlesStrategyProcessor по трейдинг конфигу, заявки выставляются через broker
+func FromConfig(tradingConfig *config.TradingConfig, s *sdk.SDK, broker sdk.Broker, logger *zap.Logger) (*CandlesStrategyProcessor, error) {
+	instrument, err := s.Instruments().GetByFigi(tradingConfig.Figi) // лотность и шаг цены для заявок
+	if err != nil {
+		return nil, xerrors.Errorf("can't receive instrument %s: %w", tradingConfig.Figi, err)
+	}
+	return FromInstrument(tradingConfig, instrument, s, broker, logger)
+}
+
+// FromInstrument создаёт CandlesStrategyProcessor по трейдинг конфигу и уже известным параметрам инструмента.
+// Для бэктеста без доступа к API s и broker могут быть nil, тогда процессором можно пользоваться только через Step
+func FromInstrument(tradingConfig *config.TradingConfig, instrument *sdk.InstrumentInfo, s *sdk.SDK, broker sdk.Broker, logger *zap.Logger) (*CandlesStrategyProcessor, error) {
 	f := rule_strategy.List[tradingConfig.StrategyConfig.Name]
 	if f == nil {
 		return nil, xerrors.Errorf("no ruleStrategy with name %s", tradingConfig.StrategyConfig.Name)
 	}
 
+	if tradingConfig.InstrumentType != "" && tradingConfig.InstrumentType != instrument.InstrumentType {
+		return nil, xerrors.Errorf(
+			"instrument %s has type %s, but trading config expects %s",
+			tradingConfig.Figi, instrument.InstrumentType, tradingConfig.InstrumentType,
+		)
+	}
+
 	tradingRecord := techan.NewTradingRecord() // создание структуры стратегии и истории трейдинга
 	ruleStrategy, timeSeries := f(*tradingConfig)
 
+	tape := sdk.NewTradesTape(tapeCapacity) // лента сделок для сверки цен исполнения
+	var tapeConsumer sdk.TradesConsumer = tape
+
 	tradingStrategy := CandlesStrategyProcessor{
 		tradingConfig: tradingConfig,
 		sdk:           s,
+		broker:        broker,
+		instrument:    instrument,
 		logger:        logger,
 		timeSeries:    timeSeries,
 		TradingRecord: tradingRecord,
 		ruleStrategy:  &ruleStrategy,
-		candles:       []tachart.Candle{},
-		events:        []tachart.Event{},
+
+		ruleStrategyFactory: f,
+		candles:             []tachart.Candle{},
+		recordMu:            &sync.Mutex{},
+		events:              []tachart.Event{},
+		tape:                tape,
+		tapeConsumer:        &tapeConsumer,
+		paused:              new(int32),
+		orderFills:          make(map[string]*trackedOrder),
+		lifecycleMu:         &sync.Mutex{},
+		inFlight:            &sync.WaitGroup{},
 	}
 
+	var candlesConsumer sdk.MarketDataConsumer = &tradingStrategy
+	tradingStrategy.candlesConsumer = &candlesConsumer
+	var fillsConsumer sdk.OrderTradesConsumer = &tradingStrategy
+	tradingStrategy.fillsConsumer = &fillsConsumer
+
 	return &tradingStrategy, nil
 }
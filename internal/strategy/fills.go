@@ -0,0 +1,130 @@
+package strategy
+
+import (
+	"time"
+
+	"github.com/sdcoffey/big"
+	"github.com/sdcoffey/techan"
+	"go.uber.org/zap"
+
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// trackedOrder накопленное исполнение одной заявки, заявка может исполняться несколькими сделками
+type trackedOrder struct {
+	op            Operation
+	direction     investapi.OrderDirection // направление из стрима, по нему находится исполнение сработавших стоп-заявок
+	orderId       string                   // идентификатор, с которым заявка выставлялась
+	lotsRequested int64
+	lotsExecuted  int64
+	turnover      decimal.Decimal // сумма цена * количество по всем сделкам
+	recorded      bool            // заявка уже добавлена в историю трейдинга
+	seen          time.Time       // когда по заявке пришла первая сделка или она была зарегистрирована
+}
+
+// untrackedOrderTTL сколько хранить исполнение заявки, которую стратегия не выставляла: ручной сделки на счёте
+// или заявки по сработавшей стоп-заявке. Этого хватает, чтобы дождаться регистрации своей заявки после ответа
+// на выставление и чтобы найти исполнение стоп-заявки при следующей проверке стоп-заявок
+const untrackedOrderTTL = 5 * time.Minute
+
+// purgeOrderFills вызывается под recordMu и удаляет заявки, которые больше не изменятся,
+// и исполнение чужих заявок старше untrackedOrderTTL
+func (w *CandlesStrategyProcessor) purgeOrderFills() {
+	for exchangeOrderId, order := range w.orderFills {
+		finished := order.lotsRequested > 0 && order.lotsExecuted >= order.lotsRequested
+		expired := order.orderId == "" && time.Since(order.seen) > untrackedOrderTTL
+		if finished || expired {
+			delete(w.orderFills, exchangeOrderId)
+		}
+	}
+}
+
+// trackOrder начинает учёт исполнения выставленной заявки по стриму исполнения.
+// Сделки, которые пришли раньше, чем заявка была зарегистрирована, применяются сразу
+func (w *CandlesStrategyProcessor) trackOrder(resp *investapi.PostOrderResponse, op Operation, orderId string) {
+	if !w.fillsStream {
+		return
+	}
+
+	w.recordMu.Lock()
+	defer w.recordMu.Unlock()
+
+	w.purgeOrderFills()
+
+	order, contains := w.orderFills[resp.GetOrderId()]
+	if !contains {
+		order = &trackedOrder{seen: time.Now()}
+		w.orderFills[resp.GetOrderId()] = order
+	}
+	order.op = op
+	order.orderId = orderId
+	order.lotsRequested = resp.GetLotsRequested()
+	if order.lotsExecuted > 0 {
+		w.recordFill(order)
+	}
+}
+
+// ConsumeOrderTrades будет вызван для каждого отчёта об исполнении заявки по figi и аккаунту из трейдинг конфига.
+// В историю трейдинга записываются реальные средняя цена и количество, частичные исполнения накапливаются
+func (w *CandlesStrategyProcessor) ConsumeOrderTrades(orderTrades *investapi.OrderTrades) {
+	w.recordMu.Lock()
+	defer w.recordMu.Unlock()
+
+	w.purgeOrderFills()
+
+	order, contains := w.orderFills[orderTrades.GetOrderId()]
+	if !contains { // заявка ещё не зарегистрирована, сделки будут учтены в trackOrder
+		order = &trackedOrder{seen: time.Now()}
+		w.orderFills[orderTrades.GetOrderId()] = order
+	}
+	order.direction = orderTrades.GetDirection()
+	for _, trade := range orderTrades.GetTrades() {
+		order.lotsExecuted += trade.GetQuantity()
+		order.turnover = order.turnover.Add(sdk.QuotationToDecimal(trade.GetPrice()).MulInt(trade.GetQuantity()))
+	}
+	if order.orderId != "" {
+		w.recordFill(order)
+	}
+
+	w.logger.Info(
+		"Order trades received",
+		zap.String("accountId", w.tradingConfig.AccountId),
+		zap.String("figi", w.tradingConfig.Figi),
+		zap.String("ticker", w.tradingConfig.Ticker),
+		zap.String("exchangeOrderId", orderTrades.GetOrderId()),
+		zap.Int64("lotsExecuted", order.lotsExecuted),
+		zap.Int64("lotsRequested", order.lotsRequested),
+	)
+}
+
+// recordFill вызывается под recordMu. Первое исполнение заявки добавляет её в историю трейдинга,
+// последующие частичные исполнения обновляют цену и количество уже добавленной заявки
+func (w *CandlesStrategyProcessor) recordFill(order *trackedOrder) {
+	if order.lotsExecuted == 0 {
+		return
+	}
+	price := order.turnover.DivInt(order.lotsExecuted)
+
+	if !order.recorded {
+		w.addEvent(order.op, order.orderId, price, order.lotsExecuted)
+		order.recorded = true
+		return
+	}
+
+	var recorded *techan.Order
+	switch position := w.TradingRecord.CurrentPosition(); {
+	case order.op == Buy && position.IsOpen():
+		recorded = position.EntranceOrder()
+	case order.op == Sell && w.TradingRecord.LastTrade() != nil:
+		recorded = w.TradingRecord.LastTrade().ExitOrder()
+	}
+	if recorded != nil && recorded.Security == order.orderId {
+		recorded.Price = price.Big()
+		recorded.Amount = big.NewFromInt(int(order.lotsExecuted))
+		if order.op == Buy {
+			w.entryPrice = price
+		}
+	}
+}
@@ -14,10 +14,10 @@ func HistoricCandleToTechanCandle(c *investapi.HistoricCandle, period time.Durat
 	timePeriod := techan.NewTimePeriod(c.Time.AsTime(), period)
 	candle := techan.NewCandle(timePeriod)
 
-	candle.OpenPrice = big.NewDecimal(sdk.QuotationToFloat(c.Open))
-	candle.ClosePrice = big.NewDecimal(sdk.QuotationToFloat(c.Close))
-	candle.MaxPrice = big.NewDecimal(sdk.QuotationToFloat(c.High))
-	candle.MinPrice = big.NewDecimal(sdk.QuotationToFloat(c.Low))
+	candle.OpenPrice = sdk.QuotationToDecimal(c.Open).Big()
+	candle.ClosePrice = sdk.QuotationToDecimal(c.Close).Big()
+	candle.MaxPrice = sdk.QuotationToDecimal(c.High).Big()
+	candle.MinPrice = sdk.QuotationToDecimal(c.Low).Big()
 	candle.Volume = big.NewFromInt(int(c.Volume))
 	return candle
 }
@@ -34,10 +34,10 @@ func CandleToTechanCandle(c *investapi.Candle, period time.Duration) *techan.Can
 	timePeriod := techan.NewTimePeriod(c.Time.AsTime(), period)
 	candle := techan.NewCandle(timePeriod)
 
-	candle.OpenPrice = big.NewDecimal(sdk.QuotationToFloat(c.Open))
-	candle.ClosePrice = big.NewDecimal(sdk.QuotationToFloat(c.Close))
-	candle.MaxPrice = big.NewDecimal(sdk.QuotationToFloat(c.High))
-	candle.MinPrice = big.NewDecimal(sdk.QuotationToFloat(c.Low))
+	candle.OpenPrice = sdk.QuotationToDecimal(c.Open).Big()
+	candle.ClosePrice = sdk.QuotationToDecimal(c.Close).Big()
+	candle.MaxPrice = sdk.QuotationToDecimal(c.High).Big()
+	candle.MinPrice = sdk.QuotationToDecimal(c.Low).Big()
 	candle.Volume = big.NewFromInt(int(c.Volume))
 	return candle
 }
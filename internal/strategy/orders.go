@@ -0,0 +1,172 @@
+package strategy
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+const (
+	orderPollInterval   = time.Second      // как часто опрашивать состояние лимитной заявки
+	defaultOrderTimeout = 30 * time.Second // сколько ждать исполнения лимитной заявки, если в конфиге не указано
+)
+
+// orderFill итог исполнения заявки
+type orderFill struct {
+	status        investapi.OrderExecutionReportStatus
+	lotsExecuted  int64
+	executedPrice decimal.Decimal
+	totalAmount   decimal.Decimal
+}
+
+// averagePrice средняя цена исполнения за 1 инструмент
+func (f *orderFill) averagePrice() decimal.Decimal {
+	if f.lotsExecuted == 0 {
+		return decimal.Zero
+	}
+	return f.executedPrice.DivInt(f.lotsExecuted)
+}
+
+// postOrder выставляет заявку на quantity лотов. Вход в позицию может быть лимитным, если это указано в трейдинг конфиге,
+// лимитная заявка выставляется по цене закрытия последней свечи, округлённой до шага цены.
+// Выход всегда рыночный, чтобы гарантированно закрыть позицию
+func (w *CandlesStrategyProcessor) postOrder(op Operation, quantity int64, orderId string) (*investapi.PostOrderResponse, string, error) {
+	figi := w.tradingConfig.Figi
+	accountId := w.tradingConfig.AccountId
+
+	if op == Buy && w.tradingConfig.StrategyConfig.OrderType == config.LimitOrder {
+		return w.broker.LimitBuy(figi, quantity, w.instrument.RoundPrice(w.lastClose), accountId, orderId)
+	}
+	if op == Buy {
+		return w.broker.MarketBuy(figi, quantity, accountId, orderId)
+	}
+	return w.broker.MarketSell(figi, quantity, accountId, orderId)
+}
+
+// awaitOrder дожидается исполнения заявки. Если заявка не исполнилась полностью за время из конфига,
+// стратегия останавливается или состояние заявки не удалось получить, заявка отменяется,
+// чтобы не осталась на бирже без присмотра, а в результате возвращается исполненная часть
+func (w *CandlesStrategyProcessor) awaitOrder(resp *investapi.PostOrderResponse) (*orderFill, error) {
+	fill := &orderFill{
+		status:        resp.GetExecutionReportStatus(),
+		lotsExecuted:  resp.GetLotsExecuted(),
+		executedPrice: sdk.MoneyValueToDecimal(resp.GetExecutedOrderPrice()),
+		totalAmount:   sdk.MoneyValueToDecimal(resp.GetTotalOrderAmount()),
+	}
+	if isOrderFinished(fill.status) {
+		return fill, nil
+	}
+
+	timeout := defaultOrderTimeout
+	if w.tradingConfig.StrategyConfig.OrderTimeout > 0 {
+		timeout = time.Duration(w.tradingConfig.StrategyConfig.OrderTimeout) * time.Second
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(orderPollInterval)
+	defer poll.Stop()
+	stopping := w.stoppingSignal()
+
+	for {
+		select {
+		case <-poll.C:
+		case <-deadline.C:
+			return w.cancelAndCollect(resp.GetOrderId())
+		case <-stopping:
+			return w.cancelAndCollect(resp.GetOrderId())
+		}
+
+		state, err := w.getOrderState(resp.GetOrderId())
+		if err != nil {
+			fill, cancelErr := w.cancelAndCollect(resp.GetOrderId())
+			if cancelErr != nil {
+				return nil, xerrors.Errorf("can't receive order state: %v, %w", err, cancelErr)
+			}
+			return fill, nil
+		}
+		if isOrderFinished(state.GetExecutionReportStatus()) {
+			return orderStateToFill(state), nil
+		}
+	}
+}
+
+// cancelAndCollect отменяет заявку и возвращает то, что успело исполниться. Если отменить не удалось,
+// заявка могла исполниться за это время, тогда возвращается её итоговое состояние
+func (w *CandlesStrategyProcessor) cancelAndCollect(orderId string) (*orderFill, error) {
+	cancelErr := w.cancelOrder(orderId)
+	state, err := w.getOrderState(orderId)
+	if err != nil {
+		if cancelErr != nil {
+			return nil, xerrors.Errorf("can't cancel order %s: %w", orderId, cancelErr)
+		}
+		return nil, err
+	}
+	if cancelErr != nil && !isOrderFinished(state.GetExecutionReportStatus()) {
+		return nil, xerrors.Errorf("can't cancel order %s: %w", orderId, cancelErr)
+	}
+	return orderStateToFill(state), nil
+}
+
+func (w *CandlesStrategyProcessor) getOrderState(orderId string) (*investapi.OrderState, error) {
+	state, _, err := w.broker.GetOrderState(w.tradingConfig.AccountId, orderId)
+	return state, err
+}
+
+func (w *CandlesStrategyProcessor) cancelOrder(orderId string) error {
+	_, _, err := w.broker.CancelOrder(w.tradingConfig.AccountId, orderId)
+	return err
+}
+
+func orderStateToFill(state *investapi.OrderState) *orderFill {
+	return &orderFill{
+		status:        state.GetExecutionReportStatus(),
+		lotsExecuted:  state.GetLotsExecuted(),
+		executedPrice: sdk.MoneyValueToDecimal(state.GetExecutedOrderPrice()),
+		totalAmount:   sdk.MoneyValueToDecimal(state.GetTotalOrderAmount()),
+	}
+}
+
+// isOrderFinished больше ли заявка не может измениться
+func isOrderFinished(status investapi.OrderExecutionReportStatus) bool {
+	return status == investapi.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_FILL ||
+		status == investapi.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_REJECTED ||
+		status == investapi.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_CANCELLED
+}
+
+// CancelOpenOrders отменяет все активные заявки по инструменту из трейдинг конфига, например при остановке робота.
+// Защитные стоп-заявки не отменяются, чтобы позиция оставалась защищённой. Возвращается первая ошибка
+func (w *CandlesStrategyProcessor) CancelOpenOrders() error {
+	orders, trackingId, err := w.broker.GetOrders(w.tradingConfig.AccountId)
+	if err != nil {
+		return xerrors.Errorf("can't receive open orders, trackingId %s: %w", trackingId, err)
+	}
+
+	var firstErr error
+	for _, order := range orders {
+		if order.GetFigi() != w.tradingConfig.Figi {
+			continue
+		}
+		_, trackingId, err = w.broker.CancelOrder(w.tradingConfig.AccountId, order.GetOrderId())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = xerrors.Errorf("can't cancel order %s: %w", order.GetOrderId(), err)
+			}
+			continue
+		}
+		w.logger.Info(
+			"Open order cancelled",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("figi", w.tradingConfig.Figi),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.String("exchangeOrderId", order.GetOrderId()),
+			zap.String("trackingId", trackingId),
+		)
+	}
+	return firstErr
+}
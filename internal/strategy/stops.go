@@ -0,0 +1,242 @@
+package strategy
+
+import (
+	"time"
+
+	"github.com/sdcoffey/techan"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+
+	"tinkoff-invest-bot/internal/config"
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// stopsCheckInterval как часто проверять, не сработали ли защитные стоп-заявки у брокера
+const stopsCheckInterval = time.Minute
+
+// protectiveStopsEnabled указаны ли в трейдинг конфиге защитные стоп-заявки
+func (w *CandlesStrategyProcessor) protectiveStopsEnabled() bool {
+	c := w.tradingConfig.StrategyConfig
+	return c.StopLossPercent > 0 || c.StopLossAtr > 0 || c.TakeProfitPercent > 0 || c.TakeProfitAtr > 0
+}
+
+// placeProtectiveStops выставляет на стороне брокера стоп-лосс и тейк-профит после входа в позицию,
+// чтобы позиция оставалась защищённой, даже если робот остановлен
+func (w *CandlesStrategyProcessor) placeProtectiveStops(entryPrice decimal.Decimal, lots int64) {
+	if !w.protectiveStopsEnabled() {
+		return
+	}
+
+	c := w.tradingConfig.StrategyConfig
+	atr := w.averageTrueRange()
+
+	if distance := stopDistance(entryPrice, c.StopLossPercent, c.StopLossAtr, atr); distance.Sign() > 0 {
+		stopType := investapi.StopOrderType_STOP_ORDER_TYPE_STOP_LOSS
+		if c.StopLossType == config.StopLimit {
+			stopType = investapi.StopOrderType_STOP_ORDER_TYPE_STOP_LIMIT
+		}
+		w.placeStop(stopType, w.instrument.RoundPrice(entryPrice.Sub(distance)), lots)
+	}
+	if distance := stopDistance(entryPrice, c.TakeProfitPercent, c.TakeProfitAtr, atr); distance.Sign() > 0 {
+		w.placeStop(investapi.StopOrderType_STOP_ORDER_TYPE_TAKE_PROFIT, w.instrument.RoundPrice(entryPrice.Add(distance)), lots)
+	}
+}
+
+func (w *CandlesStrategyProcessor) placeStop(stopType investapi.StopOrderType, stopPrice decimal.Decimal, lots int64) {
+	stopOrderId, trackingId, err := w.broker.PostStopOrder(
+		w.tradingConfig.Figi,
+		lots,
+		stopPrice,
+		stopPrice,
+		investapi.StopOrderDirection_STOP_ORDER_DIRECTION_SELL,
+		stopType,
+		w.tradingConfig.AccountId,
+	)
+	if err != nil {
+		w.logger.Info(
+			"Can't place protective stop order",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("figi", w.tradingConfig.Figi),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.String("stopOrderType", stopType.String()),
+			zap.Stringer("stopPrice", stopPrice),
+			zap.String("trackingId", trackingId),
+			zap.Error(err),
+		)
+		return
+	}
+
+	w.protectiveStops = append(w.protectiveStops, stopOrderId)
+	w.logger.Info(
+		"Protective stop order placed",
+		zap.String("accountId", w.tradingConfig.AccountId),
+		zap.String("figi", w.tradingConfig.Figi),
+		zap.String("ticker", w.tradingConfig.Ticker),
+		zap.String("stopOrderType", stopType.String()),
+		zap.Stringer("stopPrice", stopPrice),
+		zap.String("stopOrderId", stopOrderId),
+		zap.String("trackingId", trackingId),
+	)
+}
+
+// cancelProtectiveStops снимает защитные стоп-заявки, когда стратегия сама выходит из позиции.
+// Сработавшие на стороне брокера заявки отменить нельзя, такие ошибки только логируются
+func (w *CandlesStrategyProcessor) cancelProtectiveStops() {
+	for _, stopOrderId := range w.protectiveStops {
+		_, trackingId, err := w.broker.CancelStopOrder(w.tradingConfig.AccountId, stopOrderId)
+		if err != nil {
+			w.logger.Info(
+				"Can't cancel protective stop order",
+				zap.String("accountId", w.tradingConfig.AccountId),
+				zap.String("ticker", w.tradingConfig.Ticker),
+				zap.String("stopOrderId", stopOrderId),
+				zap.String("trackingId", trackingId),
+				zap.Error(err),
+			)
+		}
+	}
+	w.protectiveStops = nil
+}
+
+// reconcileProtectiveStops раз в stopsCheckInterval проверяет, остались ли защитные стоп-заявки активными.
+// Пропавшая стоп-заявка сработала, если позиции на счёте больше нет: тогда выход записывается в историю трейдинга,
+// а оставшиеся стоп-заявки снимаются. Если позиция на месте, значит стоп-заявку отменили вручную
+func (w *CandlesStrategyProcessor) reconcileProtectiveStops() {
+	if len(w.protectiveStops) == 0 || time.Since(w.lastStopsCheck) < stopsCheckInterval {
+		return
+	}
+	w.lastStopsCheck = time.Now()
+
+	active, trackingId, err := w.broker.GetStopOrders(w.tradingConfig.AccountId)
+	if err != nil {
+		w.logger.Info(
+			"Can't receive stop orders",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.String("trackingId", trackingId),
+			zap.Error(err),
+		)
+		return
+	}
+	activeIds := make(map[string]bool, len(active))
+	for _, stopOrder := range active {
+		activeIds[stopOrder.GetStopOrderId()] = true
+	}
+	var triggered string
+	remaining := make([]string, 0, len(w.protectiveStops))
+	for _, stopOrderId := range w.protectiveStops {
+		if activeIds[stopOrderId] {
+			remaining = append(remaining, stopOrderId)
+		} else {
+			triggered = stopOrderId
+		}
+	}
+	if triggered == "" {
+		return
+	}
+
+	// позиции нет совсем или лотов меньше, чем записано в истории: стоп-заявка сработала
+	lots := w.openLots()
+	isOpen, trackingId, err := w.sdk.IsAvailableForSale(w.broker, w.tradingConfig.AccountId, w.tradingConfig.Figi, lots)
+	if xerrors.Is(err, sdk.ErrNoPosition) {
+		isOpen, err = false, nil
+	}
+	if err != nil {
+		w.logger.Info(
+			"Can't check position after stop order disappeared",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.String("stopOrderId", triggered),
+			zap.String("trackingId", trackingId),
+			zap.Error(err),
+		)
+		return
+	}
+	w.protectiveStops = remaining
+	if isOpen {
+		w.logger.Info(
+			"Protective stop order was cancelled outside the robot",
+			zap.String("accountId", w.tradingConfig.AccountId),
+			zap.String("ticker", w.tradingConfig.Ticker),
+			zap.String("stopOrderId", triggered),
+		)
+		return
+	}
+
+	// второй стоп-заявке продавать уже нечего
+	w.cancelProtectiveStops()
+
+	w.recordMu.Lock()
+	price := w.takeStopFillPrice()
+	if position := w.TradingRecord.CurrentPosition(); position.IsOpen() && w.timeSeries.LastCandle() != nil {
+		w.addEvent(Sell, triggered, price, lots)
+	}
+	w.recordMu.Unlock()
+
+	w.logger.Info(
+		"Position closed by protective stop order",
+		zap.String("accountId", w.tradingConfig.AccountId),
+		zap.String("figi", w.tradingConfig.Figi),
+		zap.String("ticker", w.tradingConfig.Ticker),
+		zap.Stringer("price", price),
+		zap.Int64("lots", lots),
+		zap.String("stopOrderId", triggered),
+	)
+}
+
+// takeStopFillPrice вызывается под recordMu. Заявка, выставленная брокером по сработавшей стоп-заявке,
+// приходит в стриме исполнения под идентификатором, которого стратегия не выставляла. Средняя цена таких продаж
+// и есть цена выхода, они удаляются из учёта. Без стрима исполнения берётся цена закрытия последней свечи
+func (w *CandlesStrategyProcessor) takeStopFillPrice() decimal.Decimal {
+	var lots int64
+	turnover := decimal.Zero
+	for exchangeOrderId, order := range w.orderFills {
+		if order.orderId == "" && order.direction == investapi.OrderDirection_ORDER_DIRECTION_SELL && order.lotsExecuted > 0 {
+			lots += order.lotsExecuted
+			turnover = turnover.Add(order.turnover)
+			delete(w.orderFills, exchangeOrderId)
+		}
+	}
+	if lots == 0 {
+		return w.lastClose
+	}
+	return turnover.DivInt(lots)
+}
+
+// openLots количество лотов в открытой позиции по истории трейдинга, 0 если позиция не открыта
+func (w *CandlesStrategyProcessor) openLots() int64 {
+	w.recordMu.Lock()
+	defer w.recordMu.Unlock()
+
+	if position := w.TradingRecord.CurrentPosition(); position.IsOpen() {
+		return int64(position.EntranceOrder().Amount.Float())
+	}
+	return 0
+}
+
+// averageTrueRange значение ATR на последней свече, 0 если ATR в конфиге не используется
+func (w *CandlesStrategyProcessor) averageTrueRange() decimal.Decimal {
+	c := w.tradingConfig.StrategyConfig
+	if c.StopLossAtr <= 0 && c.TakeProfitAtr <= 0 {
+		return decimal.Zero
+	}
+	window := c.AtrWindow
+	if window <= 0 {
+		window = defaultAtrWindow
+	}
+	if w.timeSeries.LastIndex() < window {
+		return decimal.Zero
+	}
+	atr := techan.NewAverageTrueRangeIndicator(w.timeSeries, window).Calculate(w.timeSeries.LastIndex())
+	return decimal.NewFromFloat(atr.Float())
+}
+
+// stopDistance расстояние от цены входа до стоп-заявки, процент от цены имеет приоритет над ATR
+func stopDistance(entryPrice decimal.Decimal, percent float64, atrMultiplier float64, atr decimal.Decimal) decimal.Decimal {
+	if percent > 0 {
+		return entryPrice.Mul(decimal.NewFromFloat(percent)).DivInt(100)
+	}
+	return atr.Mul(decimal.NewFromFloat(atrMultiplier))
+}
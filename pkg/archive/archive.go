@@ -0,0 +1,459 @@
+// Package archive локальный архив исторических свечей.
+//
+// Архив это директория с файлом index.csv и файлами свечей <figi>_<interval>.csv.
+//
+// Файл свечей содержит заголовок time,open,high,low,close,volume и по строке на свечу:
+// время открытия свечи в RFC3339, цены десятичными дробями через точку и объём в лотах.
+// Свечи отсортированы по времени, в архиве хранятся только закрытые свечи.
+//
+// Индекс содержит заголовок figi,ticker,instrument_type,currency,lot,min_price_increment,interval,from,to,file
+// и по строке на каждый непрерывный промежуток [from, to), за который в файле file есть все свечи.
+// Свечи читаются из файла, указанного в индексе, путь берётся относительно директории архива.
+// Параметры инструмента нужны, чтобы бэктест мог работать без доступа к API.
+// Файлы сторонних источников в том же формате можно добавить в архив через Import
+package archive
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// DefaultDir директория архива по умолчанию
+const DefaultDir = "./candles/"
+
+const indexFile = "index.csv"
+
+// maxImportGap самый длинный промежуток без свечей, который при импорте считается перерывом в торгах, например
+// выходными с праздниками. Промежуток длиннее считается дырой в данных и в индекс не попадает
+const maxImportGap = 7 * 24 * time.Hour
+
+var indexHeader = []string{"figi", "ticker", "instrument_type", "currency", "lot", "min_price_increment", "interval", "from", "to", "file"}
+
+// Entry строка индекса: промежуток, за который в архиве есть свечи инструмента
+type Entry struct {
+	Figi              string
+	Ticker            string
+	InstrumentType    string
+	Currency          string
+	Lot               int64
+	MinPriceIncrement decimal.Decimal
+	Interval          string // интервал в формате конфига, например 5_MIN
+	From              time.Time
+	To                time.Time
+	File              string // имя файла свечей относительно директории архива
+}
+
+// Gap промежуток [From, To), за который в импортированном файле нет свечей и который не попал в индекс
+type Gap struct {
+	From time.Time
+	To   time.Time
+}
+
+// Archive локальный архив свечей, безопасен для использования из нескольких горутин
+type Archive struct {
+	dir string
+
+	mu      sync.Mutex
+	entries []*Entry
+	files   map[string][]*investapi.HistoricCandle // прочитанные файлы свечей
+}
+
+// Open открывает архив в директории dir. Если архива ещё нет, возвращается пустой архив
+func Open(dir string) (*Archive, error) {
+	a := &Archive{
+		dir:   dir,
+		files: make(map[string][]*investapi.HistoricCandle, 0),
+	}
+	f, err := os.Open(filepath.Join(dir, indexFile))
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("can't open archive index: %w", err)
+	}
+	defer f.Close()
+
+	a.entries, err = readIndex(f)
+	if err != nil {
+		return nil, xerrors.Errorf("can't read archive index: %w", err)
+	}
+	return a, nil
+}
+
+// Entries возвращает копию индекса архива
+func (a *Archive) Entries() []Entry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries := make([]Entry, len(a.entries))
+	for i, e := range a.entries {
+		entries[i] = *e
+	}
+	return entries
+}
+
+// Instrument параметры инструмента, сохранённые в архиве
+func (a *Archive) Instrument(figi string) (*sdk.InstrumentInfo, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, e := range a.entries {
+		if e.Figi == figi {
+			return &sdk.InstrumentInfo{
+				Figi:              e.Figi,
+				Ticker:            e.Ticker,
+				InstrumentType:    e.InstrumentType,
+				Currency:          e.Currency,
+				Lot:               e.Lot,
+				MinPriceIncrement: e.MinPriceIncrement,
+			}, true
+		}
+	}
+	return nil, false
+}
+
+// Covers есть ли в архиве все свечи инструмента за период [from, to)
+func (a *Archive) Covers(figi string, interval string, from time.Time, to time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, e := range a.entries {
+		if e.Figi == figi && e.Interval == interval && !from.Before(e.From) && !to.After(e.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// Candles возвращает свечи инструмента из архива за период [from, to), отсортированные по времени
+func (a *Archive) Candles(figi string, interval string, from time.Time, to time.Time) ([]*investapi.HistoricCandle, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	all, err := a.load(a.fileFor(figi, interval, from, to))
+	if err != nil {
+		return nil, err
+	}
+	start := sort.Search(len(all), func(i int) bool {
+		return !all[i].GetTime().AsTime().Before(from)
+	})
+	end := sort.Search(len(all), func(i int) bool {
+		return !all[i].GetTime().AsTime().Before(to)
+	})
+	candles := make([]*investapi.HistoricCandle, end-start) // копия, чтобы вызывающий мог дописывать в слайс
+	copy(candles, all[start:end])
+	return candles, nil
+}
+
+// Write добавляет в архив свечи инструмента, загруженные за период [from, to).
+// Незакрытые свечи не сохраняются, промежуток в индексе заканчивается на первой из них.
+// Если период доходит до текущей свечи, промежуток заканчивается на конце последней закрытой свечи:
+// свечи после неё ещё могут появиться, и следующая загрузка должна их докачать
+func (a *Archive) Write(instrument *sdk.InstrumentInfo, interval string, from time.Time, to time.Time, candles []*investapi.HistoricCandle) error {
+	duration := sdk.IntervalToDuration(interval)
+	var complete []*investapi.HistoricCandle
+	var lastEnd time.Time
+	for _, candle := range candles {
+		if !candle.GetIsComplete() {
+			if t := candle.GetTime().AsTime(); t.Before(to) {
+				to = t
+			}
+			continue
+		}
+		complete = append(complete, candle)
+		if end := candle.GetTime().AsTime().Add(duration); end.After(lastEnd) {
+			lastEnd = end
+		}
+	}
+	if now := time.Now(); to.After(now.Add(-duration)) {
+		if to.After(now) {
+			to = now
+		}
+		if lastEnd.Before(to) {
+			to = lastEnd
+		}
+	}
+	if !from.Before(to) {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	file := a.fileFor(instrument.Figi, interval, from, to)
+	existing, err := a.load(file)
+	if err != nil {
+		return err
+	}
+	merged := mergeCandles(existing, complete)
+	if err = a.writeFile(file, func(w io.Writer) error { return WriteCandles(w, merged) }); err != nil {
+		return xerrors.Errorf("can't write candles: %w", err)
+	}
+	a.files[file] = merged
+
+	a.addEntry(&Entry{
+		Figi:              instrument.Figi,
+		Ticker:            instrument.Ticker,
+		InstrumentType:    instrument.InstrumentType,
+		Currency:          instrument.Currency,
+		Lot:               instrument.Lot,
+		MinPriceIncrement: instrument.MinPriceIncrement,
+		Interval:          interval,
+		From:              from.UTC(),
+		To:                to.UTC(),
+		File:              file,
+	})
+	if err = a.writeFile(indexFile, func(w io.Writer) error { return writeIndex(w, a.entries) }); err != nil {
+		return xerrors.Errorf("can't write archive index: %w", err)
+	}
+	return nil
+}
+
+// Import добавляет в архив свечи из CSV файла в формате архива. Считается, что между соседними свечами
+// файла нет пропущенных свечей, если они идут не дальше maxImportGap друг от друга. Более длинные промежутки
+// без свечей в индекс не попадают и возвращаются вместе с количеством импортированных свечей
+func (a *Archive) Import(instrument *sdk.InstrumentInfo, interval string, path string) (int, []Gap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, xerrors.Errorf("can't open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	candles, err := ReadCandles(f)
+	if err != nil {
+		return 0, nil, xerrors.Errorf("can't read %s: %w", path, err)
+	}
+	if len(candles) == 0 {
+		return 0, nil, nil
+	}
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].GetTime().AsTime().Before(candles[j].GetTime().AsTime())
+	})
+
+	duration := sdk.IntervalToDuration(interval)
+	var gaps []Gap
+	start := 0
+	for i := range candles {
+		end := candles[i].GetTime().AsTime().Add(duration)
+		if i+1 < len(candles) {
+			next := candles[i+1].GetTime().AsTime()
+			if next.Sub(end) <= maxImportGap {
+				continue
+			}
+			gaps = append(gaps, Gap{From: end, To: next})
+		}
+		if err = a.Write(instrument, interval, candles[start].GetTime().AsTime(), end, candles[start:i+1]); err != nil {
+			return 0, nil, err
+		}
+		start = i + 1
+	}
+	return len(candles), gaps, nil
+}
+
+// load читает файл свечей, отсутствующий файл означает пустой список
+func (a *Archive) load(file string) ([]*investapi.HistoricCandle, error) {
+	if candles, ok := a.files[file]; ok {
+		return candles, nil
+	}
+	f, err := os.Open(filepath.Join(a.dir, file))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("can't open candles file: %w", err)
+	}
+	defer f.Close()
+
+	candles, err := ReadCandles(f)
+	if err != nil {
+		return nil, xerrors.Errorf("can't read candles file %s: %w", file, err)
+	}
+	a.files[file] = candles
+	return candles, nil
+}
+
+// writeFile записывает файл архива через временный файл, чтобы не оставить его недописанным
+func (a *Archive) writeFile(name string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(a.dir, os.ModePerm); err != nil {
+		return err
+	}
+	path := filepath.Join(a.dir, name)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err = write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// addEntry добавляет промежуток в индекс, объединяя его с пересекающимися и соседними промежутками
+func (a *Archive) addEntry(entry *Entry) {
+	entries := make([]*Entry, 0, len(a.entries)+1)
+	for _, e := range a.entries {
+		if e.Figi == entry.Figi && e.Interval == entry.Interval && !e.From.After(entry.To) && !entry.From.After(e.To) {
+			if e.From.Before(entry.From) {
+				entry.From = e.From
+			}
+			if e.To.After(entry.To) {
+				entry.To = e.To
+			}
+			continue
+		}
+		entries = append(entries, e)
+	}
+	entries = append(entries, entry)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Figi != entries[j].Figi {
+			return entries[i].Figi < entries[j].Figi
+		}
+		if entries[i].Interval != entries[j].Interval {
+			return entries[i].Interval < entries[j].Interval
+		}
+		return entries[i].From.Before(entries[j].From)
+	})
+	a.entries = entries
+}
+
+// fileFor вызывается под mu и возвращает файл свечей из индекса: файл промежутка, который покрывает [from, to),
+// иначе файл любого промежутка инструмента с тем же интервалом. Если инструмента в индексе нет, имя файла по умолчанию
+func (a *Archive) fileFor(figi string, interval string, from time.Time, to time.Time) string {
+	var file string
+	for _, e := range a.entries {
+		if e.Figi != figi || e.Interval != interval {
+			continue
+		}
+		if !from.Before(e.From) && !to.After(e.To) {
+			return e.File
+		}
+		if file == "" {
+			file = e.File
+		}
+	}
+	if file == "" {
+		file = candlesFile(figi, interval)
+	}
+	return file
+}
+
+func candlesFile(figi string, interval string) string {
+	return figi + "_" + interval + ".csv"
+}
+
+// mergeCandles объединяет отсортированные списки свечей, при совпадении времени берётся свеча из added
+func mergeCandles(existing []*investapi.HistoricCandle, added []*investapi.HistoricCandle) []*investapi.HistoricCandle {
+	byTime := make(map[int64]*investapi.HistoricCandle, len(existing)+len(added))
+	for _, candle := range existing {
+		byTime[candle.GetTime().AsTime().Unix()] = candle
+	}
+	for _, candle := range added {
+		byTime[candle.GetTime().AsTime().Unix()] = candle
+	}
+	merged := make([]*investapi.HistoricCandle, 0, len(byTime))
+	for _, candle := range byTime {
+		merged = append(merged, candle)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].GetTime().AsTime().Before(merged[j].GetTime().AsTime())
+	})
+	return merged
+}
+
+func readIndex(r io.Reader) ([]*Entry, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	var entries []*Entry
+	for i, record := range records[1:] {
+		if len(record) != len(indexHeader) {
+			return nil, xerrors.Errorf("line %d: expected %d fields, got %d", i+2, len(indexHeader), len(record))
+		}
+		entry, err := parseEntry(record)
+		if err != nil {
+			return nil, xerrors.Errorf("line %d: %w", i+2, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func parseEntry(record []string) (*Entry, error) {
+	lot, err := strconv.ParseInt(record[4], 10, 64)
+	if err != nil {
+		return nil, xerrors.Errorf("can't parse lot %q: %w", record[4], err)
+	}
+	increment, err := decimal.NewFromString(record[5])
+	if err != nil {
+		return nil, xerrors.Errorf("can't parse min price increment %q: %w", record[5], err)
+	}
+	from, err := time.Parse(time.RFC3339, record[7])
+	if err != nil {
+		return nil, xerrors.Errorf("can't parse from %q: %w", record[7], err)
+	}
+	to, err := time.Parse(time.RFC3339, record[8])
+	if err != nil {
+		return nil, xerrors.Errorf("can't parse to %q: %w", record[8], err)
+	}
+	if record[9] == "" {
+		return nil, xerrors.Errorf("empty candles file name")
+	}
+	return &Entry{
+		Figi:              record[0],
+		Ticker:            record[1],
+		InstrumentType:    record[2],
+		Currency:          record[3],
+		Lot:               lot,
+		MinPriceIncrement: increment,
+		Interval:          record[6],
+		From:              from,
+		To:                to,
+		File:              record[9],
+	}, nil
+}
+
+func writeIndex(w io.Writer, entries []*Entry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(indexHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		record := []string{
+			e.Figi,
+			e.Ticker,
+			e.InstrumentType,
+			e.Currency,
+			strconv.FormatInt(e.Lot, 10),
+			e.MinPriceIncrement.String(),
+			e.Interval,
+			e.From.Format(time.RFC3339),
+			e.To.Format(time.RFC3339),
+			e.File,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,297 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+var (
+	archiveStart = time.Date(2022, 5, 2, 10, 0, 0, 0, time.UTC)
+	instrument   = &sdk.InstrumentInfo{
+		Figi:              "FIGI",
+		Ticker:            "TICKER",
+		InstrumentType:    sdk.InstrumentTypeShare,
+		Currency:          "rub",
+		Lot:               10,
+		MinPriceIncrement: decimal.RequireFromString("0.01"),
+	}
+)
+
+// minute время через minutes минут после archiveStart
+func minute(minutes int) time.Time {
+	return archiveStart.Add(time.Duration(minutes) * time.Minute)
+}
+
+// minuteCandles закрытые минутные свечи, открывающиеся в минуты minutes, с ценой закрытия 100 + минута
+func minuteCandles(minutes ...int) []*investapi.HistoricCandle {
+	candles := make([]*investapi.HistoricCandle, len(minutes))
+	for i, m := range minutes {
+		price := sdk.DecimalToQuotation(decimal.NewFromInt(int64(100 + m)))
+		candles[i] = &investapi.HistoricCandle{
+			Time:       timestamppb.New(minute(m)),
+			Open:       price,
+			High:       price,
+			Low:        price,
+			Close:      price,
+			Volume:     int64(m),
+			IsComplete: true,
+		}
+	}
+	return candles
+}
+
+func TestWriteAndCandles(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Write(instrument, "1_MIN", minute(0), minute(5), minuteCandles(0, 1, 2, 3, 4)); err != nil {
+		t.Fatal(err)
+	}
+	// соседний промежуток склеивается с первым, незакрытая свеча 8 обрезает его
+	forming := minuteCandles(7, 8)
+	forming[1].IsComplete = false
+	if err = a.Write(instrument, "1_MIN", minute(5), minute(10), append(minuteCandles(5, 6), forming...)); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := reopened.Entries()
+	if len(entries) != 1 || !entries[0].From.Equal(minute(0)) || !entries[0].To.Equal(minute(8)) || entries[0].File != "FIGI_1_MIN.csv" {
+		t.Fatalf("entries %+v, want one entry [10:00, 10:08) in FIGI_1_MIN.csv", entries)
+	}
+	if got, ok := reopened.Instrument("FIGI"); !ok || got.Lot != 10 || got.MinPriceIncrement.String() != "0.01" || got.Ticker != "TICKER" {
+		t.Errorf("Instrument = %+v, %v", got, ok)
+	}
+
+	tests := []struct {
+		name     string
+		from, to int
+		covers   bool
+		minutes  []int
+	}{
+		{name: "whole entry", from: 0, to: 8, covers: true, minutes: []int{0, 1, 2, 3, 4, 5, 6, 7}},
+		{name: "across written periods", from: 3, to: 6, covers: true, minutes: []int{3, 4, 5}},
+		{name: "forming candle is not stored", from: 7, to: 9, covers: false, minutes: []int{7}},
+		{name: "before the entry", from: -1, to: 2, covers: false, minutes: []int{0, 1}},
+		{name: "empty period", from: 4, to: 4, covers: true},
+	}
+	for _, tt := range tests {
+		if got := reopened.Covers("FIGI", "1_MIN", minute(tt.from), minute(tt.to)); got != tt.covers {
+			t.Errorf("%s: Covers = %v, want %v", tt.name, got, tt.covers)
+		}
+		candles, err := reopened.Candles("FIGI", "1_MIN", minute(tt.from), minute(tt.to))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(candles) != len(tt.minutes) {
+			t.Errorf("%s: %d candles, want %d", tt.name, len(candles), len(tt.minutes))
+			continue
+		}
+		for i, m := range tt.minutes {
+			if !candles[i].GetTime().AsTime().Equal(minute(m)) || sdk.QuotationToDecimal(candles[i].GetClose()).String() != decimal.NewFromInt(int64(100+m)).String() {
+				t.Errorf("%s: candle %d at %s, want %s", tt.name, i, candles[i].GetTime().AsTime(), minute(m))
+			}
+		}
+	}
+	if reopened.Covers("FIGI", "5_MIN", minute(0), minute(5)) || reopened.Covers("OTHER", "1_MIN", minute(0), minute(5)) {
+		t.Errorf("archive covers another interval or instrument")
+	}
+}
+
+func TestEntriesMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		periods [][2]int
+		want    [][2]int
+	}{
+		{name: "adjacent", periods: [][2]int{{0, 5}, {5, 10}}, want: [][2]int{{0, 10}}},
+		{name: "overlapping", periods: [][2]int{{0, 6}, {4, 10}}, want: [][2]int{{0, 10}}},
+		{name: "inside", periods: [][2]int{{0, 10}, {2, 4}}, want: [][2]int{{0, 10}}},
+		{name: "separate", periods: [][2]int{{6, 10}, {0, 5}}, want: [][2]int{{0, 5}, {6, 10}}},
+		{name: "bridged", periods: [][2]int{{0, 3}, {6, 10}, {3, 6}}, want: [][2]int{{0, 10}}},
+	}
+	for _, tt := range tests {
+		a, err := Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range tt.periods {
+			if err = a.Write(instrument, "1_MIN", minute(p[0]), minute(p[1]), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entries := a.Entries()
+		if len(entries) != len(tt.want) {
+			t.Errorf("%s: %d entries, want %d", tt.name, len(entries), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			if !entries[i].From.Equal(minute(w[0])) || !entries[i].To.Equal(minute(w[1])) {
+				t.Errorf("%s: entry %d is [%s, %s), want minutes %v", tt.name, i, entries[i].From, entries[i].To, w)
+			}
+		}
+	}
+}
+
+func TestCandlesFromIndexedFile(t *testing.T) {
+	dir := t.TempDir()
+	index := strings.Join([]string{
+		strings.Join(indexHeader, ","),
+		"FIGI,TICKER,share,rub,10,0.01,1_MIN,2022-05-02T10:00:00Z,2022-05-02T10:03:00Z,other/moex.csv",
+	}, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, indexFile), []byte(index), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteCandles(&buf, minuteCandles(0, 1, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "other"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other", "moex.csv"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candles, err := a.Candles("FIGI", "1_MIN", minute(0), minute(3))
+	if err != nil || len(candles) != 3 {
+		t.Fatalf("Candles = %d candles, %v, want 3 from other/moex.csv", len(candles), err)
+	}
+
+	// дописанные свечи попадают в тот же файл, а не в файл по умолчанию
+	if err = a.Write(instrument, "1_MIN", minute(3), minute(5), minuteCandles(3, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, candlesFile("FIGI", "1_MIN"))); !os.IsNotExist(err) {
+		t.Errorf("default candles file was created: %v", err)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candles, err = reopened.Candles("FIGI", "1_MIN", minute(0), minute(5))
+	if err != nil || len(candles) != 5 {
+		t.Errorf("Candles = %d candles, %v, want 5", len(candles), err)
+	}
+	if entries := reopened.Entries(); len(entries) != 1 || entries[0].File != "other/moex.csv" || !entries[0].To.Equal(minute(5)) {
+		t.Errorf("entries %+v, want one entry up to 10:05 in other/moex.csv", entries)
+	}
+}
+
+func TestImport(t *testing.T) {
+	day := 24 * 60
+	tests := []struct {
+		name    string
+		minutes []int
+		entries [][2]int
+		gaps    [][2]int
+	}{
+		{name: "contiguous", minutes: []int{2, 0, 1}, entries: [][2]int{{0, 3}}},
+		{name: "missing minutes and a weekend", minutes: []int{0, 5, 3 * day}, entries: [][2]int{{0, 3*day + 1}}},
+		{name: "exactly the longest break", minutes: []int{0, 7*day + 1}, entries: [][2]int{{0, 7*day + 2}}},
+		{
+			name:    "gap",
+			minutes: []int{0, 1, 7*day + 3, 7*day + 4, 20 * day},
+			entries: [][2]int{{0, 2}, {7*day + 3, 7*day + 5}, {20 * day, 20*day + 1}},
+			gaps:    [][2]int{{2, 7*day + 3}, {7*day + 5, 20 * day}},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		var buf bytes.Buffer
+		if err := WriteCandles(&buf, minuteCandles(tt.minutes...)); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "import.csv")
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		a, err := Open(filepath.Join(dir, "archive"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count, gaps, err := a.Import(instrument, "1_MIN", path)
+		if err != nil || count != len(tt.minutes) {
+			t.Errorf("%s: Import = %d, %v, want %d candles", tt.name, count, err, len(tt.minutes))
+			continue
+		}
+		if len(gaps) != len(tt.gaps) {
+			t.Errorf("%s: gaps %v, want %v", tt.name, gaps, tt.gaps)
+		} else {
+			for i, g := range tt.gaps {
+				if !gaps[i].From.Equal(minute(g[0])) || !gaps[i].To.Equal(minute(g[1])) {
+					t.Errorf("%s: gap %d is [%s, %s), want minutes %v", tt.name, i, gaps[i].From, gaps[i].To, g)
+				}
+			}
+		}
+		entries := a.Entries()
+		if len(entries) != len(tt.entries) {
+			t.Errorf("%s: entries %+v, want %v", tt.name, entries, tt.entries)
+			continue
+		}
+		for i, e := range tt.entries {
+			if !entries[i].From.Equal(minute(e[0])) || !entries[i].To.Equal(minute(e[1])) {
+				t.Errorf("%s: entry %d is [%s, %s), want minutes %v", tt.name, i, entries[i].From, entries[i].To, e)
+			}
+		}
+	}
+}
+
+func TestCandlesCSV(t *testing.T) {
+	candles := minuteCandles(0, 1)
+	candles[1].Close = sdk.DecimalToQuotation(decimal.RequireFromString("-0.000000001"))
+	var buf bytes.Buffer
+	if err := WriteCandles(&buf, candles); err != nil {
+		t.Fatal(err)
+	}
+	want := "time,open,high,low,close,volume\n" +
+		"2022-05-02T10:00:00Z,100,100,100,100,0\n" +
+		"2022-05-02T10:01:00Z,101,101,101,-0.000000001,1\n"
+	if buf.String() != want {
+		t.Fatalf("WriteCandles wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+	read, err := ReadCandles(strings.NewReader(want))
+	if err != nil || len(read) != 2 {
+		t.Fatalf("ReadCandles = %d candles, %v", len(read), err)
+	}
+	if !read[1].GetIsComplete() || read[1].GetVolume() != 1 || sdk.QuotationToDecimal(read[1].GetClose()).String() != "-0.000000001" {
+		t.Errorf("read candle %v", read[1])
+	}
+
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{name: "wrong header", in: "time,open,high,low,volume,close\n"},
+		{name: "bad time", in: "time,open,high,low,close,volume\n2022-05-02,1,1,1,1,1\n"},
+		{name: "bad price", in: "time,open,high,low,close,volume\n2022-05-02T10:00:00Z,1,1,1,1e2,1\n"},
+		{name: "bad volume", in: "time,open,high,low,close,volume\n2022-05-02T10:00:00Z,1,1,1,1,x\n"},
+		{name: "missing field", in: "time,open,high,low,close,volume\n2022-05-02T10:00:00Z,1,1,1,1\n"},
+	}
+	for _, tt := range tests {
+		if _, err := ReadCandles(strings.NewReader(tt.in)); err == nil {
+			t.Errorf("%s: ReadCandles succeeded", tt.name)
+		}
+	}
+}
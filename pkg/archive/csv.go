@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+	"tinkoff-invest-bot/pkg/sdk"
+)
+
+// candlesHeader заголовок CSV файла со свечами
+var candlesHeader = []string{"time", "open", "high", "low", "close", "volume"}
+
+// ReadCandles читает свечи в формате архива. Все прочитанные свечи считаются закрытыми
+func ReadCandles(r io.Reader) ([]*investapi.HistoricCandle, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(candlesHeader)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("can't read candles header: %w", err)
+	}
+	for i, column := range candlesHeader {
+		if header[i] != column {
+			return nil, xerrors.Errorf("unexpected candles header %v, expected %v", header, candlesHeader)
+		}
+	}
+
+	var candles []*investapi.HistoricCandle
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return candles, nil
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("can't read candle: %w", err)
+		}
+		candle, err := parseCandle(record)
+		if err != nil {
+			return nil, xerrors.Errorf("line %d: %w", line, err)
+		}
+		candles = append(candles, candle)
+	}
+}
+
+// WriteCandles записывает свечи в формате архива
+func WriteCandles(w io.Writer, candles []*investapi.HistoricCandle) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(candlesHeader); err != nil {
+		return err
+	}
+	for _, candle := range candles {
+		record := []string{
+			candle.GetTime().AsTime().UTC().Format(time.RFC3339),
+			sdk.QuotationToDecimal(candle.GetOpen()).String(),
+			sdk.QuotationToDecimal(candle.GetHigh()).String(),
+			sdk.QuotationToDecimal(candle.GetLow()).String(),
+			sdk.QuotationToDecimal(candle.GetClose()).String(),
+			strconv.FormatInt(candle.GetVolume(), 10),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func parseCandle(record []string) (*investapi.HistoricCandle, error) {
+	t, err := time.Parse(time.RFC3339, record[0])
+	if err != nil {
+		return nil, xerrors.Errorf("can't parse time %q: %w", record[0], err)
+	}
+	prices := make([]decimal.Decimal, 4)
+	for i := range prices {
+		prices[i], err = decimal.NewFromString(record[i+1])
+		if err != nil {
+			return nil, xerrors.Errorf("can't parse %s %q: %w", candlesHeader[i+1], record[i+1], err)
+		}
+	}
+	volume, err := strconv.ParseInt(record[5], 10, 64)
+	if err != nil {
+		return nil, xerrors.Errorf("can't parse volume %q: %w", record[5], err)
+	}
+	return &investapi.HistoricCandle{
+		Time:       timestamppb.New(t),
+		Open:       sdk.DecimalToQuotation(prices[0]),
+		High:       sdk.DecimalToQuotation(prices[1]),
+		Low:        sdk.DecimalToQuotation(prices[2]),
+		Close:      sdk.DecimalToQuotation(prices[3]),
+		Volume:     volume,
+		IsComplete: true,
+	}, nil
+}
@@ -0,0 +1,305 @@
+package decimal
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	techanbig "github.com/sdcoffey/big"
+)
+
+// Precision количество знаков после запятой, столько же знаков в nano у Quotation и MoneyValue
+const Precision = 9
+
+var (
+	scale = big.NewInt(1000000000)
+
+	// Zero нулевое значение, равно Decimal{}
+	Zero = Decimal{}
+)
+
+// Decimal десятичное число с фиксированной точностью в 9 знаков после запятой.
+// Представление точное, поэтому цены и суммы из API переводятся в Decimal и обратно без потерь.
+// Значение неизменяемое, нулевое значение Decimal{} равно 0
+type Decimal struct {
+	v *big.Int // значение, умноженное на 10^9
+}
+
+// New создаёт число units + nano / 10^9, так же как устроены Quotation и MoneyValue
+func New(units int64, nano int32) Decimal {
+	v := new(big.Int).Mul(big.NewInt(units), scale)
+	return Decimal{v: v.Add(v, big.NewInt(int64(nano)))}
+}
+
+// NewFromInt создаёт целое число
+func NewFromInt(i int64) Decimal {
+	return New(i, 0)
+}
+
+// NewFromFloat создаёт число из float64, округляя до 9 знаков после запятой
+func NewFromFloat(f float64) Decimal {
+	d, err := NewFromString(strconv.FormatFloat(f, 'f', Precision, 64))
+	if err != nil {
+		panic(fmt.Sprintf("can't convert %v to decimal: %v", f, err))
+	}
+	return d
+}
+
+// NewFromString разбирает число вида "-123.456" с не более чем одним знаком перед ним,
+// лишние знаки после запятой округляются
+func NewFromString(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	negative := strings.HasPrefix(str, "-")
+	if negative || strings.HasPrefix(str, "+") {
+		str = str[1:]
+	}
+
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return Zero, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	roundUp := false
+	if len(fracPart) > Precision {
+		roundUp = fracPart[Precision] >= '5'
+		fracPart = fracPart[:Precision]
+	}
+	fracPart += strings.Repeat("0", Precision-len(fracPart))
+
+	v, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return Zero, fmt.Errorf("invalid decimal %q", s)
+	}
+	if roundUp {
+		v.Add(v, big.NewInt(1))
+	}
+	if negative {
+		v.Neg(v)
+	}
+	return Decimal{v: v}, nil
+}
+
+// isDigits состоит ли строка только из десятичных цифр, пустая строка считается корректной
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequireFromString как NewFromString, но паникует на некорректной строке
+func RequireFromString(s string) Decimal {
+	d, err := NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) value() *big.Int {
+	if d.v == nil {
+		return new(big.Int)
+	}
+	return d.v
+}
+
+// Units целая часть числа
+func (d Decimal) Units() int64 {
+	return new(big.Int).Quo(d.value(), scale).Int64()
+}
+
+// Nano дробная часть числа в миллиардных долях, знак совпадает со знаком целой части
+func (d Decimal) Nano() int32 {
+	return int32(new(big.Int).Rem(d.value(), scale).Int64())
+}
+
+// Add возвращает d + other
+func (d Decimal) Add(other Decimal) Decimal {
+	return Decimal{v: new(big.Int).Add(d.value(), other.value())}
+}
+
+// Sub возвращает d - other
+func (d Decimal) Sub(other Decimal) Decimal {
+	return Decimal{v: new(big.Int).Sub(d.value(), other.value())}
+}
+
+// Mul возвращает d * other, округлённое до 9 знаков
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{v: quoRound(new(big.Int).Mul(d.value(), other.value()), scale)}
+}
+
+// MulInt возвращает d * i
+func (d Decimal) MulInt(i int64) Decimal {
+	return Decimal{v: new(big.Int).Mul(d.value(), big.NewInt(i))}
+}
+
+// Div возвращает d / other, округлённое до 9 знаков. Паникует при делении на ноль
+func (d Decimal) Div(other Decimal) Decimal {
+	if other.IsZero() {
+		panic("decimal division by zero")
+	}
+	return Decimal{v: quoRound(new(big.Int).Mul(d.value(), scale), other.value())}
+}
+
+// DivInt возвращает d / i, округлённое до 9 знаков. Паникует при делении на ноль
+func (d Decimal) DivInt(i int64) Decimal {
+	if i == 0 {
+		panic("decimal division by zero")
+	}
+	return Decimal{v: quoRound(d.value(), big.NewInt(i))}
+}
+
+// Neg возвращает -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{v: new(big.Int).Neg(d.value())}
+}
+
+// Abs возвращает |d|
+func (d Decimal) Abs() Decimal {
+	return Decimal{v: new(big.Int).Abs(d.value())}
+}
+
+// Sign возвращает -1, 0 или 1
+func (d Decimal) Sign() int {
+	return d.value().Sign()
+}
+
+// Cmp сравнивает числа: -1 если d < other, 0 если равны, 1 если d > other
+func (d Decimal) Cmp(other Decimal) int {
+	return d.value().Cmp(other.value())
+}
+
+// Equal равны ли числа
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+// LessThan d < other
+func (d Decimal) LessThan(other Decimal) bool {
+	return d.Cmp(other) < 0
+}
+
+// GreaterThan d > other
+func (d Decimal) GreaterThan(other Decimal) bool {
+	return d.Cmp(other) > 0
+}
+
+// IsZero равно ли число нулю
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// RoundToStep округляет до ближайшего числа, кратного step (например, шагу цены инструмента)
+func (d Decimal) RoundToStep(step Decimal) Decimal {
+	if step.Sign() <= 0 {
+		return d
+	}
+	q := quoRound(d.value(), step.value())
+	return Decimal{v: q.Mul(q, step.value())}
+}
+
+// FloorToStep округляет вниз до числа, кратного step
+func (d Decimal) FloorToStep(step Decimal) Decimal {
+	if step.Sign() <= 0 {
+		return d
+	}
+	q := new(big.Int).Div(d.value(), step.value()) // Div в math/big округляет к минус бесконечности для положительного делителя
+	return Decimal{v: q.Mul(q, step.value())}
+}
+
+// CeilToStep округляет вверх до числа, кратного step
+func (d Decimal) CeilToStep(step Decimal) Decimal {
+	return d.Neg().FloorToStep(step).Neg()
+}
+
+// Float приближённое значение в float64, только для отображения и индикаторов
+func (d Decimal) Float() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Big переводит число в big.Decimal, с которым работает techan
+func (d Decimal) Big() techanbig.Decimal {
+	return techanbig.NewFromString(d.String())
+}
+
+// String представление без лишних нулей, например "-12.5"
+func (d Decimal) String() string {
+	abs := new(big.Int).Abs(d.value())
+	intPart, fracPart := new(big.Int).QuoRem(abs, scale, new(big.Int))
+
+	s := intPart.String()
+	if fracPart.Sign() != 0 {
+		frac := fmt.Sprintf("%09d", fracPart.Int64())
+		s += "." + strings.TrimRight(frac, "0")
+	}
+	if d.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// StringFixed представление с указанным количеством знаков после запятой.
+// Больше 9 знаков дополняются нулями, отрицательное количество считается нулём
+func (d Decimal) StringFixed(places int) string {
+	if places < 0 {
+		places = 0
+	}
+	padding := 0
+	if places > Precision {
+		padding = places - Precision
+		places = Precision
+	}
+	step := Decimal{v: new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Precision-places)), nil)}
+	rounded := d.RoundToStep(step)
+
+	abs := new(big.Int).Abs(rounded.value())
+	intPart, fracPart := new(big.Int).QuoRem(abs, scale, new(big.Int))
+	s := intPart.String()
+	if places > 0 {
+		s += "." + fmt.Sprintf("%09d", fracPart.Int64())[:places] + strings.Repeat("0", padding)
+	}
+	if rounded.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// MarshalText позволяет сохранять число в yaml и json без потерь
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText разбирает число из yaml и json
+func (d *Decimal) UnmarshalText(text []byte) error {
+	parsed, err := NewFromString(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// quoRound делит x на y с округлением половины от нуля
+func quoRound(x *big.Int, y *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	twiceRem := new(big.Int).Abs(r)
+	twiceRem.Lsh(twiceRem, 1)
+	if twiceRem.Cmp(new(big.Int).Abs(y)) >= 0 {
+		if (x.Sign() < 0) != (y.Sign() < 0) {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
@@ -0,0 +1,154 @@
+package decimal
+
+import (
+	"testing"
+)
+
+func TestNewFromString(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "0", want: "0"},
+		{in: "123.456", want: "123.456"},
+		{in: "-123.456", want: "-123.456"},
+		{in: "+5", want: "5"},
+		{in: " 7.50 ", want: "7.5"},
+		{in: ".5", want: "0.5"},
+		{in: "-.5", want: "-0.5"},
+		{in: "5.", want: "5"},
+		{in: "0.0000000014", want: "0.000000001"},
+		{in: "0.0000000015", want: "0.000000002"},
+		{in: "-0.0000000015", want: "-0.000000002"},
+		{in: "0.9999999999", want: "1"},
+		{in: "", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: "--5", wantErr: true},
+		{in: "+-5", wantErr: true},
+		{in: "-+5", wantErr: true},
+		{in: "5-", wantErr: true},
+		{in: "1.-5", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "1,5", wantErr: true},
+		{in: "1e5", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1.0000000001abc", wantErr: true},
+		{in: "1.123456789z", wantErr: true},
+		{in: "2.5000000000-", wantErr: true},
+		{in: "1.1234567891 ", want: "1.123456789"},
+	}
+	for _, tt := range tests {
+		got, err := NewFromString(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewFromString(%q) = %s, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewFromString(%q) unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("NewFromString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRounding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{name: "half up", got: RequireFromString("0.000000005").DivInt(2), want: "0.000000003"},
+		{name: "half away from zero on negative", got: RequireFromString("-0.000000005").DivInt(2), want: "-0.000000003"},
+		{name: "below half on negative", got: RequireFromString("-0.000000004").DivInt(3), want: "-0.000000001"},
+		{name: "negative divisor", got: RequireFromString("0.000000005").DivInt(-2), want: "-0.000000003"},
+		{name: "div", got: RequireFromString("-2").Div(RequireFromString("3")), want: "-0.666666667"},
+		{name: "mul", got: RequireFromString("-0.00001").Mul(RequireFromString("0.00005")), want: "-0.000000001"},
+		{name: "mul below half", got: RequireFromString("-0.00001").Mul(RequireFromString("0.00004")), want: "0"},
+	}
+	for _, tt := range tests {
+		if tt.got.String() != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestUnitsNano(t *testing.T) {
+	tests := []struct {
+		in    string
+		units int64
+		nano  int32
+	}{
+		{in: "0", units: 0, nano: 0},
+		{in: "114.25", units: 114, nano: 250000000},
+		{in: "-114.25", units: -114, nano: -250000000},
+		{in: "-0.000000001", units: 0, nano: -1},
+		{in: "-0.5", units: 0, nano: -500000000},
+		{in: "-3", units: -3, nano: 0},
+	}
+	for _, tt := range tests {
+		d := RequireFromString(tt.in)
+		if d.Units() != tt.units || d.Nano() != tt.nano {
+			t.Errorf("%s: units %d nano %d, want %d %d", tt.in, d.Units(), d.Nano(), tt.units, tt.nano)
+		}
+		if back := New(d.Units(), d.Nano()); !back.Equal(d) {
+			t.Errorf("%s: round trip through units and nano gave %s", tt.in, back)
+		}
+	}
+}
+
+func TestToStep(t *testing.T) {
+	tests := []struct {
+		in, step           string
+		round, floor, ceil string
+	}{
+		{in: "100.26", step: "0.05", round: "100.25", floor: "100.25", ceil: "100.3"},
+		{in: "100.275", step: "0.05", round: "100.3", floor: "100.25", ceil: "100.3"},
+		{in: "100.25", step: "0.05", round: "100.25", floor: "100.25", ceil: "100.25"},
+		{in: "-100.26", step: "0.05", round: "-100.25", floor: "-100.3", ceil: "-100.25"},
+		{in: "-100.275", step: "0.05", round: "-100.3", floor: "-100.3", ceil: "-100.25"},
+		{in: "7", step: "0", round: "7", floor: "7", ceil: "7"},
+		{in: "0.0123", step: "0.0025", round: "0.0125", floor: "0.01", ceil: "0.0125"},
+	}
+	for _, tt := range tests {
+		d, step := RequireFromString(tt.in), RequireFromString(tt.step)
+		if got := d.RoundToStep(step).String(); got != tt.round {
+			t.Errorf("RoundToStep(%s, %s) = %s, want %s", tt.in, tt.step, got, tt.round)
+		}
+		if got := d.FloorToStep(step).String(); got != tt.floor {
+			t.Errorf("FloorToStep(%s, %s) = %s, want %s", tt.in, tt.step, got, tt.floor)
+		}
+		if got := d.CeilToStep(step).String(); got != tt.ceil {
+			t.Errorf("CeilToStep(%s, %s) = %s, want %s", tt.in, tt.step, got, tt.ceil)
+		}
+	}
+}
+
+func TestStringFixed(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int
+		want   string
+	}{
+		{in: "1.5", places: 0, want: "2"},
+		{in: "-1.5", places: 0, want: "-2"},
+		{in: "1.005", places: 2, want: "1.01"},
+		{in: "-1.005", places: 2, want: "-1.01"},
+		{in: "-0.004", places: 2, want: "0.00"},
+		{in: "12", places: 3, want: "12.000"},
+		{in: "0.123456789", places: 9, want: "0.123456789"},
+		{in: "1.5", places: 10, want: "1.5000000000"},
+		{in: "-0.000000001", places: 12, want: "-0.000000001000"},
+		{in: "2.5", places: -1, want: "3"},
+	}
+	for _, tt := range tests {
+		if got := RequireFromString(tt.in).StringFixed(tt.places); got != tt.want {
+			t.Errorf("StringFixed(%s, %d) = %s, want %s", tt.in, tt.places, got, tt.want)
+		}
+	}
+}
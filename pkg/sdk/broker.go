@@ -0,0 +1,203 @@
+package sdk
+
+import (
+	"time"
+
+	"golang.org/x/xerrors"
+
+	api "tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+)
+
+// Broker единый интерфейс для работы со счётом: заявки, позиции, портфель, операции и аккаунты.
+// Скрывает разницу между реальными и Sandbox аккаунтами, поэтому код стратегий не зависит от того,
+// где он торгует. Чтобы подключить ещё один вид счёта (например, симулятор), достаточно реализовать этот интерфейс
+type Broker interface {
+	// GetAccounts возвращает аккаунты, к которым есть доступ по текущему токену
+	GetAccounts() ([]*api.Account, string, error)
+	// GetPortfolio возвращает портфолио аккаунта
+	GetPortfolio(accountId string) (*api.PortfolioResponse, string, error)
+	// GetPositions возвращает все активные позиции аккаунта
+	GetPositions(accountId string) (*api.PositionsResponse, string, error)
+	// GetOperations возвращает операции, выполненные на аккаунте за указанный период
+	GetOperations(accountId string, from time.Time, to time.Time, figi string) ([]*api.Operation, string, error)
+
+	// MarketBuy выставляет рыночную заявку на покупку
+	MarketBuy(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error)
+	// MarketSell выставляет рыночную заявку на продажу
+	MarketSell(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error)
+	// LimitBuy выставляет лимитную заявку на покупку по цене price за 1 инструмент
+	LimitBuy(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error)
+	// LimitSell выставляет лимитную заявку на продажу по цене price за 1 инструмент
+	LimitSell(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error)
+	// CancelOrder отменяет выставленную заявку
+	CancelOrder(accountId string, orderId string) (*api.CancelOrderResponse, string, error)
+	// GetOrderState возвращает текущее состояние заявки
+	GetOrderState(accountId string, orderId string) (*api.OrderState, string, error)
+	// GetOrders возвращает все активные заявки аккаунта
+	GetOrders(accountId string) ([]*api.OrderState, string, error)
+
+	// PostStopOrder выставляет бессрочную стоп-заявку и возвращает её идентификатор
+	PostStopOrder(figi string, quantity int64, price decimal.Decimal, stopPrice decimal.Decimal, direction api.StopOrderDirection, stopOrderType api.StopOrderType, accountId string) (string, string, error)
+	// GetStopOrders возвращает все активные стоп-заявки аккаунта
+	GetStopOrders(accountId string) ([]*api.StopOrder, string, error)
+	// CancelStopOrder отменяет стоп-заявку
+	CancelStopOrder(accountId string, stopOrderId string) (*api.CancelStopOrderResponse, string, error)
+
+	// SubscribeOrderTrades подписывает консьюмера на отчёты об исполнении заявок по инструменту
+	SubscribeOrderTrades(accountId string, figi string, consumer *OrderTradesConsumer) error
+	// UnsubscribeOrderTrades отписывает консьюмера от отчётов об исполнении заявок
+	UnsubscribeOrderTrades(accountId string, figi string, consumer *OrderTradesConsumer) error
+}
+
+// NewBroker возвращает брокера для реального или Sandbox аккаунта
+func NewBroker(s *SDK, isSandbox bool) Broker {
+	if isSandbox {
+		return &sandboxBroker{sdk: s}
+	}
+	return &realBroker{sdk: s}
+}
+
+// realBroker торгует на реальных счетах
+type realBroker struct {
+	sdk *SDK
+}
+
+func (b *realBroker) GetAccounts() ([]*api.Account, string, error) {
+	return b.sdk.GetAccounts()
+}
+
+func (b *realBroker) GetPortfolio(accountId string) (*api.PortfolioResponse, string, error) {
+	return b.sdk.GetPortfolio(accountId)
+}
+
+func (b *realBroker) GetPositions(accountId string) (*api.PositionsResponse, string, error) {
+	return b.sdk.GetPositions(accountId)
+}
+
+func (b *realBroker) GetOperations(accountId string, from time.Time, to time.Time, figi string) ([]*api.Operation, string, error) {
+	return b.sdk.GetOperations(accountId, from, to, figi)
+}
+
+func (b *realBroker) MarketBuy(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return b.sdk.RealMarketBuy(figi, quantity, accountId, orderId)
+}
+
+func (b *realBroker) MarketSell(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return b.sdk.RealMarketSell(figi, quantity, accountId, orderId)
+}
+
+func (b *realBroker) LimitBuy(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return b.sdk.RealLimitBuy(figi, quantity, price, accountId, orderId)
+}
+
+func (b *realBroker) LimitSell(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return b.sdk.RealLimitSell(figi, quantity, price, accountId, orderId)
+}
+
+func (b *realBroker) CancelOrder(accountId string, orderId string) (*api.CancelOrderResponse, string, error) {
+	return b.sdk.CancelOrder(accountId, orderId)
+}
+
+func (b *realBroker) GetOrderState(accountId string, orderId string) (*api.OrderState, string, error) {
+	return b.sdk.GetOrderState(accountId, orderId)
+}
+
+func (b *realBroker) GetOrders(accountId string) ([]*api.OrderState, string, error) {
+	return b.sdk.GetOrders(accountId)
+}
+
+func (b *realBroker) PostStopOrder(figi string, quantity int64, price decimal.Decimal, stopPrice decimal.Decimal, direction api.StopOrderDirection, stopOrderType api.StopOrderType, accountId string) (string, string, error) {
+	return b.sdk.PostStopOrder(figi, quantity, price, stopPrice, direction, stopOrderType, accountId)
+}
+
+func (b *realBroker) GetStopOrders(accountId string) ([]*api.StopOrder, string, error) {
+	return b.sdk.GetStopOrders(accountId)
+}
+
+func (b *realBroker) CancelStopOrder(accountId string, stopOrderId string) (*api.CancelStopOrderResponse, string, error) {
+	return b.sdk.CancelStopOrder(accountId, stopOrderId)
+}
+
+func (b *realBroker) SubscribeOrderTrades(accountId string, figi string, consumer *OrderTradesConsumer) error {
+	return b.sdk.SubscribeOrderTrades(accountId, figi, consumer)
+}
+
+func (b *realBroker) UnsubscribeOrderTrades(accountId string, figi string, consumer *OrderTradesConsumer) error {
+	return b.sdk.UnsubscribeOrderTrades(accountId, figi, consumer)
+}
+
+// sandboxBroker торгует на Sandbox счетах
+type sandboxBroker struct {
+	sdk *SDK
+}
+
+// Sandbox не поддерживает стоп-заявки и стрим исполнения заявок
+var (
+	errStopOrdersNotSupported  = xerrors.New("stop orders are not supported in sandbox")
+	errOrderTradesNotSupported = xerrors.New("order trades stream is not supported in sandbox")
+)
+
+func (b *sandboxBroker) GetAccounts() ([]*api.Account, string, error) {
+	return b.sdk.GetSandboxAccounts()
+}
+
+func (b *sandboxBroker) GetPortfolio(accountId string) (*api.PortfolioResponse, string, error) {
+	return b.sdk.GetSandboxPortfolio(accountId)
+}
+
+func (b *sandboxBroker) GetPositions(accountId string) (*api.PositionsResponse, string, error) {
+	return b.sdk.GetSandboxPositions(accountId)
+}
+
+func (b *sandboxBroker) GetOperations(accountId string, from time.Time, to time.Time, figi string) ([]*api.Operation, string, error) {
+	return b.sdk.GetSandboxOperations(accountId, from, to, figi)
+}
+
+func (b *sandboxBroker) MarketBuy(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return b.sdk.SandboxMarketBuy(figi, quantity, accountId, orderId)
+}
+
+func (b *sandboxBroker) MarketSell(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return b.sdk.SandboxMarketSell(figi, quantity, accountId, orderId)
+}
+
+func (b *sandboxBroker) LimitBuy(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return b.sdk.SandboxLimitBuy(figi, quantity, price, accountId, orderId)
+}
+
+func (b *sandboxBroker) LimitSell(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return b.sdk.SandboxLimitSell(figi, quantity, price, accountId, orderId)
+}
+
+func (b *sandboxBroker) CancelOrder(accountId string, orderId string) (*api.CancelOrderResponse, string, error) {
+	return b.sdk.CancelSandboxOrder(accountId, orderId)
+}
+
+func (b *sandboxBroker) GetOrderState(accountId string, orderId string) (*api.OrderState, string, error) {
+	return b.sdk.GetSandboxOrderState(accountId, orderId)
+}
+
+func (b *sandboxBroker) GetOrders(accountId string) ([]*api.OrderState, string, error) {
+	return b.sdk.GetSandboxOrders(accountId)
+}
+
+func (b *sandboxBroker) PostStopOrder(string, int64, decimal.Decimal, decimal.Decimal, api.StopOrderDirection, api.StopOrderType, string) (string, string, error) {
+	return "", "", errStopOrdersNotSupported
+}
+
+func (b *sandboxBroker) GetStopOrders(string) ([]*api.StopOrder, string, error) {
+	return nil, "", errStopOrdersNotSupported
+}
+
+func (b *sandboxBroker) CancelStopOrder(string, string) (*api.CancelStopOrderResponse, string, error) {
+	return nil, "", errStopOrdersNotSupported
+}
+
+func (b *sandboxBroker) SubscribeOrderTrades(string, string, *OrderTradesConsumer) error {
+	return errOrderTradesNotSupported
+}
+
+func (b *sandboxBroker) UnsubscribeOrderTrades(string, string, *OrderTradesConsumer) error {
+	return errOrderTradesNotSupported
+}
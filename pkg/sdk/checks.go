@@ -1,83 +1,61 @@
 package sdk
 
 import (
+	"strings"
 	"time"
 
 	"golang.org/x/xerrors"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/protobuf/types/known/timestamppb"
 
 	api "tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
 )
 
-// CanTradeNow Возможно ли торговать инструментом в данный момент времени
-func (s *SDK) CanTradeNow(exchange string) (bool, string, error) {
-	var header, trailer metadata.MD
-
-	now := timestamppb.New(time.Now().UTC())
-	resp, err := s.instruments.TradingSchedules(
-		s.ctx, &api.TradingSchedulesRequest{
-			From:     now,
-			To:       now,
-			Exchange: exchange,
-		},
-		grpc.Header(&header),
-		grpc.Trailer(&trailer),
-	)
-	trackingId := extractTrackingId(&header, &trailer)
+// ErrNoPosition на счёте нет позиции по инструменту, например после продажи всех лотов
+var ErrNoPosition = xerrors.New("no position")
 
+// CanTradeNow Возможно ли торговать инструментом в данный момент времени.
+// Учитываются все площадки из расписания, а также основная и вечерняя сессии
+func (s *SDK) CanTradeNow(exchange string) (bool, string, error) {
+	now := time.Now().UTC()
+	sessions, trackingId, err := s.GetTradingSessions(exchange, now, now)
 	if err != nil {
-		if extractedError := extractRequestError(&trailer); extractedError != nil {
-			return false, trackingId, extractedError
-		}
 		return false, trackingId, err
 	}
 
-	if len((*resp).GetExchanges()) > 0 && len((*resp).GetExchanges()[0].GetDays()) > 0 {
-		schedule := (*resp).GetExchanges()[0].GetDays()[0]
-		if !schedule.GetIsTradingDay() {
-			return false, trackingId, nil
+	for _, session := range sessions {
+		if session.Contains(now) {
+			return true, trackingId, nil
 		}
-
-		startTime := schedule.GetStartTime().AsTime()
-		endTime := schedule.GetEndTime().AsTime()
-		nowTime := time.Now().UTC()
-
-		if startTime.Sub(nowTime) < 0 && nowTime.Sub(endTime) < 0 {
-			return true, trackingId, err
-		}
-		return false, trackingId, err
 	}
 	return false, trackingId, nil
 }
 
-// IsEnoughMoneyToBuy достаточно ли денег на счёте для покупки акциий
-func (s *SDK) IsEnoughMoneyToBuy(accountId string, isSandbox bool, figi string, currency string, quantity int64) (bool, string, error) {
-	var positions *api.PositionsResponse
-	var trackingId string
-	var err error
+// IsNormalTrading Идёт ли по инструменту нормальная торговля (не аукцион, не перерыв и не остановка торгов)
+func IsNormalTrading(status api.SecurityTradingStatus) bool {
+	return status == api.SecurityTradingStatus_SECURITY_TRADING_STATUS_NORMAL_TRADING ||
+		status == api.SecurityTradingStatus_SECURITY_TRADING_STATUS_DEALER_NORMAL_TRADING
+}
 
-	if isSandbox {
-		positions, trackingId, err = s.GetSandboxPositions(accountId)
-		if err != nil {
-			return false, trackingId, xerrors.Errorf("can't receive Sandbox positions: %w", err)
-		}
-	} else {
-		positions, trackingId, err = s.GetPositions(accountId)
-		if err != nil {
-			return false, trackingId, xerrors.Errorf("can't receive positions: %w", err)
-		}
+// IsEnoughMoneyToBuy достаточно ли денег на счёте для покупки quantity лотов инструмента
+func (s *SDK) IsEnoughMoneyToBuy(broker Broker, accountId string, figi string, currency string, quantity int64) (bool, string, error) {
+	instrument, err := s.Instruments().GetByFigi(figi)
+	if err != nil {
+		return false, "", xerrors.Errorf("can't receive instrument: %w", err)
 	}
 
-	price, trackingId, err := s.GetLastPrice(figi)
+	positions, trackingId, err := broker.GetPositions(accountId)
 	if err != nil {
-		return false, trackingId, xerrors.Errorf("can't receive last price: %w", err)
+		return false, trackingId, xerrors.Errorf("can't receive positions: %w", err)
+	}
+
+	cost, trackingId, err := s.lotsCost(instrument, quantity)
+	if err != nil {
+		return false, trackingId, err
 	}
 
 	for _, money := range positions.Money { // foreach our money
 		if money.Currency == currency {
-			if float64(quantity)*QuotationToFloat(price.Price) < MoneyValueToFloat(money) { // if enough to buy
+			if cost.LessThan(MoneyValueToDecimal(money)) { // if enough to buy
 				return true, trackingId, nil
 			} else {
 				return false, trackingId, nil // not enough money to buy
@@ -87,32 +65,60 @@ func (s *SDK) IsEnoughMoneyToBuy(accountId string, isSandbox bool, figi string,
 	return false, trackingId, xerrors.Errorf("No money with currency %s", currency)
 }
 
-// IsAvailableForSale Есть ли у пользователя акции, чтобы продать их
-func (s *SDK) IsAvailableForSale(accountId string, isSandbox bool, figi string, quantity int64) (bool, string, error) {
-	var positions *api.PositionsResponse
-	var trackingId string
-	var err error
+// IsAvailableForSale Есть ли у пользователя quantity лотов инструмента, чтобы продать их
+func (s *SDK) IsAvailableForSale(broker Broker, accountId string, figi string, quantity int64) (bool, string, error) {
+	instrument, err := s.Instruments().GetByFigi(figi)
+	if err != nil {
+		return false, "", xerrors.Errorf("can't receive instrument: %w", err)
+	}
+
+	positions, trackingId, err := broker.GetPositions(accountId)
+	if err != nil {
+		return false, trackingId, xerrors.Errorf("can't receive positions: %w", err)
+	}
 
-	if isSandbox {
-		positions, trackingId, err = s.GetSandboxPositions(accountId)
-		if err != nil {
-			return false, trackingId, xerrors.Errorf("can't receive Sandbox positions: %w", err)
+	units := instrument.LotsToUnits(quantity) // баланс хранится в штуках, а не в лотах
+	switch instrument.InstrumentType {
+	case InstrumentTypeFuture:
+		for _, future := range positions.GetFutures() {
+			if future.Figi == figi {
+				return future.Balance >= units, trackingId, nil
+			}
 		}
-	} else {
-		positions, trackingId, err = s.GetPositions(accountId)
-		if err != nil {
-			return false, trackingId, xerrors.Errorf("can't receive positions: %w", err)
+	case InstrumentTypeCurrency: // купленная валюта лежит на счёте как денежная позиция
+		for _, money := range positions.GetMoney() {
+			if strings.EqualFold(money.Currency, instrument.IsoCurrencyName) {
+				return !MoneyValueToDecimal(money).LessThan(decimal.NewFromInt(units)), trackingId, nil
+			}
+		}
+	default:
+		for _, secur := range positions.GetSecurities() {
+			if secur.Figi == figi {
+				if secur.Balance >= units { // if enough to sell
+					return true, trackingId, nil
+				} else {
+					return false, trackingId, nil
+				}
+			}
 		}
 	}
+	return false, trackingId, xerrors.Errorf("No security with figi %s: %w", figi, ErrNoPosition)
+}
 
-	for _, secur := range positions.GetSecurities() {
-		if secur.Figi == figi {
-			if secur.Balance >= quantity { // if enough to sell
-				return true, trackingId, nil
-			} else {
-				return false, trackingId, nil
-			}
+// lotsCost сколько денег нужно для покупки quantity лотов: для фьючерсов это гарантийное обеспечение,
+// для остальных инструментов стоимость лотов по последней цене
+func (s *SDK) lotsCost(instrument *InstrumentInfo, quantity int64) (decimal.Decimal, string, error) {
+	if instrument.InstrumentType == InstrumentTypeFuture {
+		margin, trackingId, err := s.GetFuturesMargin(instrument.Figi)
+		if err != nil {
+			return decimal.Zero, trackingId, xerrors.Errorf("can't receive futures margin: %w", err)
 		}
+		return MoneyValueToDecimal(margin.GetInitialMarginOnBuy()).MulInt(quantity), trackingId, nil
+	}
+
+	price, trackingId, err := s.GetLastPrice(instrument.Figi)
+	if err != nil {
+		return decimal.Zero, trackingId, xerrors.Errorf("can't receive last price: %w", err)
 	}
-	return false, trackingId, xerrors.Errorf("No security with figi %s", figi)
+	return instrument.LotPrice(QuotationToDecimal(price.Price)).MulInt(quantity), trackingId, nil
 }
@@ -0,0 +1,174 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	api "tinkoff-invest-bot/investapi"
+)
+
+// consumerQueueSize сколько сообщений может ждать в очереди консьюмера. Свечи, стаканы и торговые статусы
+// при переполнении не отбрасываются, а заменяют ожидающее сообщение с тем же ключом
+const consumerQueueSize = 256
+
+// messageKey ключ, по которому более новое сообщение заменяет ещё не доставленное:
+// обновление той же свечи, стакан того же инструмента и глубины, торговый статус инструмента
+type messageKey struct {
+	kind     string
+	figi     string
+	interval api.SubscriptionInterval
+	depth    int32
+	time     time.Time
+}
+
+// coalesceKey ключ сообщения, false для сообщений, которые нельзя заменять, например обезличенных сделок
+func coalesceKey(message *api.MarketDataResponse) (messageKey, bool) {
+	switch {
+	case message.GetCandle() != nil:
+		candle := message.GetCandle()
+		return messageKey{kind: "candle", figi: candle.GetFigi(), interval: candle.GetInterval(), time: candle.GetTime().AsTime()}, true
+	case message.GetOrderbook() != nil:
+		return messageKey{kind: "orderbook", figi: message.GetOrderbook().GetFigi(), depth: message.GetOrderbook().GetDepth()}, true
+	case message.GetTradingStatus() != nil:
+		return messageKey{kind: "status", figi: message.GetTradingStatus().GetFigi()}, true
+	}
+	return messageKey{}, false
+}
+
+// subscriber подписка одного консьюмера. У каждого консьюмера своя очередь и своя горутина,
+// поэтому медленный Consume не задерживает доставку сообщений остальным консьюмерам
+type subscriber struct {
+	id      interface{} // указатель на консьюмера, по нему ищется подписка при отписке
+	deliver func(message *api.MarketDataResponse)
+	logger  *zap.Logger
+
+	mu      sync.Mutex
+	pending []*api.MarketDataResponse
+	keys    map[messageKey]int // индекс ожидающего сообщения в pending по его ключу
+	closed  bool
+	wake    chan struct{}
+}
+
+func newSubscriber(id interface{}, logger *zap.Logger, deliver func(message *api.MarketDataResponse)) *subscriber {
+	sub := &subscriber{
+		id:      id,
+		deliver: deliver,
+		logger:  logger,
+		keys:    make(map[messageKey]int),
+		wake:    make(chan struct{}, 1),
+	}
+	go sub.run()
+	return sub
+}
+
+// run доставляет сообщения консьюмеру по порядку, пока подписка не закрыта и очередь не опустела
+func (sub *subscriber) run() {
+	for range sub.wake {
+		for {
+			sub.mu.Lock()
+			batch, closed := sub.pending, sub.closed
+			sub.pending = nil
+			sub.keys = make(map[messageKey]int)
+			sub.mu.Unlock()
+
+			if len(batch) == 0 {
+				if closed {
+					return
+				}
+				break
+			}
+			for _, message := range batch {
+				sub.deliver(message)
+			}
+		}
+	}
+}
+
+// post кладёт сообщение в очередь консьюмера не блокируясь. Сообщение с тем же ключом, что и ожидающее доставки,
+// заменяет его, поэтому последний торговый статус и последнее обновление свечи всегда доходят до консьюмера.
+// Отбрасываются только обезличенные сделки, когда очередь переполнена
+func (sub *subscriber) post(message *api.MarketDataResponse) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return
+	}
+
+	key, coalesce := coalesceKey(message)
+	if coalesce {
+		if i, ok := sub.keys[key]; ok {
+			sub.pending[i] = message
+			return
+		}
+	} else if len(sub.pending) >= consumerQueueSize {
+		sub.logger.Warn("Consumer queue is full, market data message dropped", zap.String("figi", message.GetTrade().GetFigi()))
+		return
+	}
+
+	sub.pending = append(sub.pending, message)
+	if coalesce {
+		sub.keys[key] = len(sub.pending) - 1
+	}
+	select {
+	case sub.wake <- struct{}{}:
+	default: // горутина уже разбужена
+	}
+}
+
+// close останавливает горутину консьюмера после того, как она обработает уже полученные сообщения
+func (sub *subscriber) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.closed = true
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// removeSubscriber удаляет подписку консьюмера id из списка и останавливает её
+func removeSubscriber(subscribers []*subscriber, id interface{}) ([]*subscriber, bool) {
+	for i, sub := range subscribers {
+		if sub.id == id {
+			sub.close()
+			rest := make([]*subscriber, 0, len(subscribers)-1)
+			rest = append(rest, subscribers[:i]...)
+			return append(rest, subscribers[i+1:]...), true
+		}
+	}
+	return subscribers, false
+}
+
+// dispatch рассылает сообщение из стрима подписанным на него консьюмерам
+func (s *SDK) dispatch(newMessage *api.MarketDataResponse) {
+	if newMessage == nil {
+		return
+	}
+
+	s.registryMu.RLock()
+	defer s.registryMu.RUnlock()
+
+	var subscribers []*subscriber
+	switch {
+	case newMessage.GetCandle() != nil: // notify candles subscribers
+		subscribers = s.candlesConsumers[candlesKey{
+			figi:     newMessage.GetCandle().GetFigi(),
+			interval: newMessage.GetCandle().GetInterval(),
+		}]
+	case newMessage.GetOrderbook() != nil: // notify order book subscribers
+		subscribers = s.orderBookConsumers[orderBookKey{
+			figi:  newMessage.GetOrderbook().GetFigi(),
+			depth: newMessage.GetOrderbook().GetDepth(),
+		}]
+	case newMessage.GetTrade() != nil: // notify trades subscribers
+		subscribers = s.tradesConsumers[newMessage.GetTrade().GetFigi()]
+	case newMessage.GetTradingStatus() != nil: // notify trading status subscribers
+		subscribers = s.infoConsumers[newMessage.GetTradingStatus().GetFigi()]
+	}
+
+	for _, sub := range subscribers {
+		sub.post(newMessage)
+	}
+}
@@ -0,0 +1,102 @@
+package sdk
+
+import (
+	"context"
+	"time"
+
+	api "tinkoff-invest-bot/investapi"
+)
+
+// fillsKey ключ подписки на исполнение заявок, отчёты доставляются по аккаунту и инструменту
+type fillsKey struct {
+	accountId string
+	figi      string
+}
+
+// SubscribeOrderTrades Подписать консьюмера на исполнение заявок по инструменту на аккаунте.
+// На каждый аккаунт открывается один стрим TradesStream, он переоткрывается при обрыве
+func (s *SDK) SubscribeOrderTrades(accountId string, figi string, consumer *OrderTradesConsumer) error {
+	s.fillsMu.Lock()
+	defer s.fillsMu.Unlock()
+
+	key := fillsKey{accountId: accountId, figi: figi}
+	s.fillsConsumers[key] = append(s.fillsConsumers[key], consumer)
+
+	if _, running := s.fillsStreams[accountId]; !running {
+		ctx, cancel := context.WithCancel(s.ctx)
+		s.fillsStreams[accountId] = cancel
+		go s.runFillsStream(ctx, accountId)
+	}
+	return nil
+}
+
+// UnsubscribeOrderTrades Отписать консьюмера от исполнения заявок.
+// Стрим аккаунта закрывается, когда на нём не остаётся ни одного консьюмера
+func (s *SDK) UnsubscribeOrderTrades(accountId string, figi string, consumer *OrderTradesConsumer) error {
+	s.fillsMu.Lock()
+	defer s.fillsMu.Unlock()
+
+	key := fillsKey{accountId: accountId, figi: figi}
+	consumers := s.fillsConsumers[key]
+	for i, c := range consumers {
+		if c == consumer {
+			consumers = append(consumers[:i:i], consumers[i+1:]...)
+			break
+		}
+	}
+	if len(consumers) == 0 {
+		delete(s.fillsConsumers, key)
+	} else {
+		s.fillsConsumers[key] = consumers
+	}
+
+	for k := range s.fillsConsumers {
+		if k.accountId == accountId {
+			return nil
+		}
+	}
+	if cancel, running := s.fillsStreams[accountId]; running {
+		cancel()
+		delete(s.fillsStreams, accountId)
+	}
+	return nil
+}
+
+// runFillsStream читает стрим исполнения заявок аккаунта и переоткрывает его при обрыве, пока не отменён ctx
+func (s *SDK) runFillsStream(ctx context.Context, accountId string) {
+	delay := minReconnectDelay
+	for {
+		stream, err := s.ordersStream.TradesStream(ctx, &api.TradesStreamRequest{Accounts: []string{accountId}})
+		if err == nil {
+			for {
+				resp, err := stream.Recv()
+				if err != nil {
+					break
+				}
+				delay = minReconnectDelay
+				if orderTrades := resp.GetOrderTrades(); orderTrades != nil {
+					s.dispatchOrderTrades(orderTrades)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = nextReconnectDelay(delay)
+	}
+}
+
+func (s *SDK) dispatchOrderTrades(orderTrades *api.OrderTrades) {
+	s.fillsMu.Lock()
+	key := fillsKey{accountId: orderTrades.GetAccountId(), figi: orderTrades.GetFigi()}
+	consumers := make([]*OrderTradesConsumer, len(s.fillsConsumers[key]))
+	copy(consumers, s.fillsConsumers[key])
+	s.fillsMu.Unlock()
+
+	for _, consumer := range consumers {
+		(*consumer).ConsumeOrderTrades(orderTrades)
+	}
+}
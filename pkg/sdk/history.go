@@ -0,0 +1,229 @@
+package sdk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/protobuf/proto"
+
+	api "tinkoff-invest-bot/investapi"
+)
+
+const (
+	// DefaultHistoryCacheDir директория, в которой по умолчанию хранятся скачанные свечи
+	DefaultHistoryCacheDir = "./cache/candles/"
+
+	historyConcurrency        = 4                      // сколько отрезков истории скачивается одновременно
+	historyMinRequestInterval = 250 * time.Millisecond // не больше 240 запросов свечей в минуту, лимит API 300
+)
+
+// CandleIntervalToMaxRequestPeriod максимальный период, за который GetCandles отдаёт свечи интервала за один запрос
+func CandleIntervalToMaxRequestPeriod(interval api.CandleInterval) time.Duration {
+	switch interval {
+	case api.CandleInterval_CANDLE_INTERVAL_1_MIN, api.CandleInterval_CANDLE_INTERVAL_5_MIN, api.CandleInterval_CANDLE_INTERVAL_15_MIN:
+		return 24 * time.Hour
+	case api.CandleInterval_CANDLE_INTERVAL_HOUR:
+		return 7 * 24 * time.Hour
+	case api.CandleInterval_CANDLE_INTERVAL_DAY:
+		return 365 * 24 * time.Hour
+	default:
+		panic(fmt.Sprintf("Интервал свечи %s не поддерживается", interval))
+	}
+}
+
+// HistoryService загружает исторические свечи за любой период. Период разбивается на отрезки, которые API отдаёт
+// за один запрос, отрезки скачиваются параллельно с ограничением частоты запросов. Полностью закрытые отрезки
+// сохраняются на диск, поэтому повторные бэктесты и разогрев роботов не скачивают те же свечи заново
+type HistoryService struct {
+	sdk      *SDK
+	cacheDir string
+
+	throttleMu  sync.Mutex
+	nextRequest time.Time // раньше этого момента новый запрос отправлять нельзя
+}
+
+// NewHistoryService создаёт сервис истории, который кэширует свечи в cacheDir. Пустой cacheDir отключает кэш
+func NewHistoryService(s *SDK, cacheDir string) *HistoryService {
+	return &HistoryService{
+		sdk:      s,
+		cacheDir: cacheDir,
+	}
+}
+
+// History возвращает сервис истории SDK с кэшем в DefaultHistoryCacheDir
+func (s *SDK) History() *HistoryService {
+	return s.history
+}
+
+// historyChunk отрезок истории, который загружается одним запросом
+type historyChunk struct {
+	from time.Time
+	to   time.Time
+}
+
+// GetCandles возвращает свечи инструмента за период [from, to), отсортированные по времени
+func (h *HistoryService) GetCandles(figi string, from time.Time, to time.Time, interval api.CandleInterval) ([]*api.HistoricCandle, error) {
+	chunks := splitHistory(from.UTC(), to.UTC(), CandleIntervalToMaxRequestPeriod(interval))
+	results := make([][]*api.HistoricCandle, len(chunks))
+
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	jobs := make(chan int)
+	for i := 0; i < historyConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				candles, err := h.loadChunk(figi, chunks[idx], interval)
+				if err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					continue
+				}
+				results[idx] = candles
+			}
+		}()
+	}
+	for i := range chunks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	var candles []*api.HistoricCandle
+	for _, chunk := range results {
+		for _, candle := range chunk {
+			t := candle.GetTime().AsTime()
+			if t.Before(from) || !t.Before(to) {
+				continue
+			}
+			candles = append(candles, candle)
+		}
+	}
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].GetTime().AsTime().Before(candles[j].GetTime().AsTime())
+	})
+	return dedupCandles(candles), nil
+}
+
+// splitHistory разбивает период на отрезки длиной step, выровненные по step от начала эпохи,
+// чтобы у одинаковых отрезков в разных запросах были одинаковые ключи в кэше
+func splitHistory(from time.Time, to time.Time, step time.Duration) []historyChunk {
+	var chunks []historyChunk
+	for start := from.Truncate(step); start.Before(to); start = start.Add(step) {
+		chunks = append(chunks, historyChunk{from: start, to: start.Add(step)})
+	}
+	return chunks
+}
+
+// loadChunk берёт отрезок из кэша или скачивает его. В кэш попадают только отрезки, в которых все свечи закрыты
+func (h *HistoryService) loadChunk(figi string, chunk historyChunk, interval api.CandleInterval) ([]*api.HistoricCandle, error) {
+	path := h.chunkPath(figi, chunk, interval)
+	if path != "" {
+		if candles, ok := readCachedChunk(path); ok {
+			return candles, nil
+		}
+	}
+
+	h.throttle()
+	candles, trackingId, err := h.sdk.GetCandles(figi, chunk.from, chunk.to, interval)
+	if err != nil {
+		return nil, xerrors.Errorf("can't receive candles from %v to %v, trackingId %s: %w", chunk.from, chunk.to, trackingId, err)
+	}
+
+	if path != "" && isChunkFinished(chunk, candles) {
+		if err = writeCachedChunk(path, candles); err != nil {
+			return nil, xerrors.Errorf("can't write candles cache: %w", err)
+		}
+	}
+	return candles, nil
+}
+
+// throttle выдерживает паузу между запросами, общую для всех горутин сервиса
+func (h *HistoryService) throttle() {
+	h.throttleMu.Lock()
+	now := time.Now()
+	wait := h.nextRequest.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	h.nextRequest = now.Add(wait + historyMinRequestInterval)
+	h.throttleMu.Unlock()
+
+	time.Sleep(wait)
+}
+
+func (h *HistoryService) chunkPath(figi string, chunk historyChunk, interval api.CandleInterval) string {
+	if h.cacheDir == "" {
+		return ""
+	}
+	return filepath.Join(h.cacheDir, figi, interval.String(), chunk.from.Format("2006-01-02T15-04")+".pb")
+}
+
+// isChunkFinished закончился ли отрезок и закрыты ли все его свечи, то есть отрезок больше не изменится
+func isChunkFinished(chunk historyChunk, candles []*api.HistoricCandle) bool {
+	if time.Now().Before(chunk.to) {
+		return false
+	}
+	for _, candle := range candles {
+		if !candle.GetIsComplete() {
+			return false
+		}
+	}
+	return true
+}
+
+func readCachedChunk(path string) ([]*api.HistoricCandle, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var cached api.GetCandlesResponse
+	if err = proto.Unmarshal(data, &cached); err != nil {
+		return nil, false // повреждённый файл будет перезаписан
+	}
+	return cached.GetCandles(), true
+}
+
+func writeCachedChunk(path string, candles []*api.HistoricCandle) error {
+	data, err := proto.Marshal(&api.GetCandlesResponse{Candles: candles})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	// запись через временный файл, чтобы параллельный читатель не увидел недописанный отрезок
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// dedupCandles убирает свечи с одинаковым временем на стыках отрезков, оставляя последнюю
+func dedupCandles(candles []*api.HistoricCandle) []*api.HistoricCandle {
+	result := make([]*api.HistoricCandle, 0, len(candles))
+	for _, candle := range candles {
+		if n := len(result); n > 0 && result[n-1].GetTime().AsTime().Equal(candle.GetTime().AsTime()) {
+			result[n-1] = candle
+			continue
+		}
+		result = append(result, candle)
+	}
+	return result
+}
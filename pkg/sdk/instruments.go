@@ -0,0 +1,336 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"tinkoff-invest-bot/pkg/decimal"
+)
+
+// DefaultInstrumentsRefreshInterval как часто обновлять справочник инструментов
+const DefaultInstrumentsRefreshInterval = 6 * time.Hour
+
+// Типы инструментов, в том виде, в котором их возвращает API
+const (
+	InstrumentTypeShare    = "share"
+	InstrumentTypeEtf      = "etf"
+	InstrumentTypeBond     = "bond"
+	InstrumentTypeFuture   = "futures"
+	InstrumentTypeCurrency = "currency"
+)
+
+// InstrumentInfo основные параметры инструмента, нужные для торговли
+type InstrumentInfo struct {
+	Figi              string
+	Ticker            string
+	ClassCode         string
+	Name              string
+	Currency          string
+	Exchange          string
+	InstrumentType    string
+	Lot               int64           // количество инструментов в одном лоте
+	MinPriceIncrement decimal.Decimal // шаг цены
+	IsoCurrencyName   string          // ISO-код валюты, только для валют
+}
+
+// LotsToUnits переводит количество лотов в количество инструментов
+func (i *InstrumentInfo) LotsToUnits(lots int64) int64 {
+	return lots * i.lot()
+}
+
+// UnitsToLots переводит количество инструментов в количество целых лотов, остаток отбрасывается
+func (i *InstrumentInfo) UnitsToLots(units int64) int64 {
+	return units / i.lot()
+}
+
+// LotPrice стоимость одного лота по цене за 1 инструмент
+func (i *InstrumentInfo) LotPrice(price decimal.Decimal) decimal.Decimal {
+	return price.MulInt(i.lot())
+}
+
+// RoundPrice округляет цену до ближайшего шага цены инструмента
+func (i *InstrumentInfo) RoundPrice(price decimal.Decimal) decimal.Decimal {
+	return price.RoundToStep(i.MinPriceIncrement)
+}
+
+// FloorPrice округляет цену вниз до шага цены инструмента
+func (i *InstrumentInfo) FloorPrice(price decimal.Decimal) decimal.Decimal {
+	return price.FloorToStep(i.MinPriceIncrement)
+}
+
+// CeilPrice округляет цену вверх до шага цены инструмента
+func (i *InstrumentInfo) CeilPrice(price decimal.Decimal) decimal.Decimal {
+	return price.CeilToStep(i.MinPriceIncrement)
+}
+
+func (i *InstrumentInfo) lot() int64 {
+	if i.Lot <= 0 {
+		return 1
+	}
+	return i.Lot
+}
+
+// InstrumentsCache справочник инструментов всех типов: акции, фонды, облигации, фьючерсы и валюты.
+// Загружается целиком при первом обращении и периодически обновляется, пока SDK работает
+type InstrumentsCache struct {
+	sdk             *SDK
+	refreshInterval time.Duration
+	loadMu          sync.Mutex // первая загрузка выполняется одна, остальные обращения её дожидаются
+
+	mu       sync.RWMutex
+	loaded   bool
+	byFigi   map[string]*InstrumentInfo
+	byTicker map[string][]*InstrumentInfo // у одного тикера может быть несколько инструментов на разных площадках
+}
+
+// NewInstrumentsCache создаёт справочник инструментов, refreshInterval задаёт период обновления
+func NewInstrumentsCache(s *SDK, refreshInterval time.Duration) *InstrumentsCache {
+	return &InstrumentsCache{
+		sdk:             s,
+		refreshInterval: refreshInterval,
+		byFigi:          make(map[string]*InstrumentInfo, 0),
+		byTicker:        make(map[string][]*InstrumentInfo, 0),
+	}
+}
+
+// Instruments возвращает справочник инструментов SDK
+func (s *SDK) Instruments() *InstrumentsCache {
+	return s.instrumentsCache
+}
+
+// GetByFigi возвращает инструмент по figi. Если инструмента нет в справочнике, он запрашивается отдельно
+func (c *InstrumentsCache) GetByFigi(figi string) (*InstrumentInfo, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	instrument, ok := c.byFigi[figi]
+	c.mu.RUnlock()
+	if ok {
+		return instrument, nil
+	}
+
+	// инструмента нет в списках для торговли (например, он появился после последнего обновления)
+	resp, _, err := c.sdk.GetInstrumentByFigi(figi)
+	if err != nil {
+		return nil, xerrors.Errorf("can't receive instrument %s: %w", figi, err)
+	}
+	instrument = &InstrumentInfo{
+		Figi:              resp.GetFigi(),
+		Ticker:            resp.GetTicker(),
+		ClassCode:         resp.GetClassCode(),
+		Name:              resp.GetName(),
+		Currency:          resp.GetCurrency(),
+		Exchange:          resp.GetExchange(),
+		InstrumentType:    resp.GetInstrumentType(),
+		Lot:               int64(resp.GetLot()),
+		MinPriceIncrement: QuotationToDecimal(resp.GetMinPriceIncrement()),
+	}
+	c.mu.Lock()
+	c.add(instrument)
+	c.mu.Unlock()
+	return instrument, nil
+}
+
+// GetByTicker возвращает все инструменты с указанным тикером
+func (c *InstrumentsCache) GetByTicker(ticker string) ([]*InstrumentInfo, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	instruments := make([]*InstrumentInfo, len(c.byTicker[ticker]))
+	copy(instruments, c.byTicker[ticker])
+	return instruments, nil
+}
+
+// GetByType возвращает все инструменты указанного типа, например InstrumentTypeEtf
+func (c *InstrumentsCache) GetByType(instrumentType string) ([]*InstrumentInfo, error) {
+	if err := c.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var instruments []*InstrumentInfo
+	for _, instrument := range c.byFigi {
+		if instrument.InstrumentType == instrumentType {
+			instruments = append(instruments, instrument)
+		}
+	}
+	return instruments, nil
+}
+
+// Refresh заново загружает все инструменты. Если какой-то тип загрузить не удалось, старые данные сохраняются
+func (c *InstrumentsCache) Refresh() error {
+	var instruments []*InstrumentInfo
+	var errs []error
+
+	shares, _, err := c.sdk.GetShares()
+	errs = appendError(errs, err)
+	for _, share := range shares {
+		instruments = append(instruments, &InstrumentInfo{
+			Figi:              share.GetFigi(),
+			Ticker:            share.GetTicker(),
+			ClassCode:         share.GetClassCode(),
+			Name:              share.GetName(),
+			Currency:          share.GetCurrency(),
+			Exchange:          share.GetExchange(),
+			InstrumentType:    InstrumentTypeShare,
+			Lot:               int64(share.GetLot()),
+			MinPriceIncrement: QuotationToDecimal(share.GetMinPriceIncrement()),
+		})
+	}
+
+	etfs, _, err := c.sdk.GetEtfs()
+	errs = appendError(errs, err)
+	for _, etf := range etfs {
+		instruments = append(instruments, &InstrumentInfo{
+			Figi:              etf.GetFigi(),
+			Ticker:            etf.GetTicker(),
+			ClassCode:         etf.GetClassCode(),
+			Name:              etf.GetName(),
+			Currency:          etf.GetCurrency(),
+			Exchange:          etf.GetExchange(),
+			InstrumentType:    InstrumentTypeEtf,
+			Lot:               int64(etf.GetLot()),
+			MinPriceIncrement: QuotationToDecimal(etf.GetMinPriceIncrement()),
+		})
+	}
+
+	bonds, _, err := c.sdk.GetBonds()
+	errs = appendError(errs, err)
+	for _, bond := range bonds {
+		instruments = append(instruments, &InstrumentInfo{
+			Figi:              bond.GetFigi(),
+			Ticker:            bond.GetTicker(),
+			ClassCode:         bond.GetClassCode(),
+			Name:              bond.GetName(),
+			Currency:          bond.GetCurrency(),
+			Exchange:          bond.GetExchange(),
+			InstrumentType:    InstrumentTypeBond,
+			Lot:               int64(bond.GetLot()),
+			MinPriceIncrement: QuotationToDecimal(bond.GetMinPriceIncrement()),
+		})
+	}
+
+	futures, _, err := c.sdk.GetFutures()
+	errs = appendError(errs, err)
+	for _, future := range futures {
+		instruments = append(instruments, &InstrumentInfo{
+			Figi:              future.GetFigi(),
+			Ticker:            future.GetTicker(),
+			ClassCode:         future.GetClassCode(),
+			Name:              future.GetName(),
+			Currency:          future.GetCurrency(),
+			Exchange:          future.GetExchange(),
+			InstrumentType:    InstrumentTypeFuture,
+			Lot:               int64(future.GetLot()),
+			MinPriceIncrement: QuotationToDecimal(future.GetMinPriceIncrement()),
+		})
+	}
+
+	currencies, _, err := c.sdk.GetCurrencies()
+	errs = appendError(errs, err)
+	for _, currency := range currencies {
+		instruments = append(instruments, &InstrumentInfo{
+			Figi:              currency.GetFigi(),
+			Ticker:            currency.GetTicker(),
+			ClassCode:         currency.GetClassCode(),
+			Name:              currency.GetName(),
+			Currency:          currency.GetCurrency(),
+			Exchange:          currency.GetExchange(),
+			InstrumentType:    InstrumentTypeCurrency,
+			Lot:               int64(currency.GetLot()),
+			MinPriceIncrement: QuotationToDecimal(currency.GetMinPriceIncrement()),
+			IsoCurrencyName:   currency.GetIsoCurrencyName(),
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(instruments) == 0 {
+		return xerrors.Errorf("can't load instruments: %v", errs)
+	}
+	for _, instrument := range instruments {
+		c.add(instrument)
+	}
+	if !c.loaded {
+		c.loaded = true
+		go c.refreshLoop()
+	}
+	if len(errs) > 0 {
+		return xerrors.Errorf("instruments are loaded partially: %v", errs)
+	}
+	return nil
+}
+
+// ensureLoaded загружает справочник при первом обращении. Одновременные обращения дожидаются одной загрузки,
+// если она не удалась, следующее обращение загружает справочник заново
+func (c *InstrumentsCache) ensureLoaded() error {
+	c.mu.RLock()
+	loaded := c.loaded
+	c.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	c.loadMu.Lock()
+	defer c.loadMu.Unlock()
+	c.mu.RLock()
+	loaded = c.loaded
+	c.mu.RUnlock()
+	if loaded { // справочник загрузился, пока ждали своей очереди
+		return nil
+	}
+
+	err := c.Refresh()
+	c.mu.RLock()
+	loaded = c.loaded
+	c.mu.RUnlock()
+	if loaded { // частичная загрузка не мешает работать с загруженными инструментами
+		return nil
+	}
+	return err
+}
+
+// refreshLoop периодически обновляет справочник, пока SDK не остановлен
+func (c *InstrumentsCache) refreshLoop() {
+	ticker := time.NewTicker(c.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.sdk.ctx.Done():
+			return
+		case <-ticker.C:
+			_ = c.Refresh() // при ошибке остаются данные с прошлого обновления
+		}
+	}
+}
+
+// add вызывается под mu, заменяет инструмент с тем же figi
+func (c *InstrumentsCache) add(instrument *InstrumentInfo) {
+	if old, ok := c.byFigi[instrument.Figi]; ok {
+		byTicker := c.byTicker[old.Ticker]
+		for i, existing := range byTicker {
+			if existing == old {
+				c.byTicker[old.Ticker] = append(byTicker[:i], byTicker[i+1:]...)
+				break
+			}
+		}
+	}
+	c.byFigi[instrument.Figi] = instrument
+	c.byTicker[instrument.Ticker] = append(c.byTicker[instrument.Ticker], instrument)
+}
+
+func appendError(errs []error, err error) []error {
+	if err != nil {
+		return append(errs, err)
+	}
+	return errs
+}
@@ -0,0 +1,65 @@
+package sdk
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	api "tinkoff-invest-bot/investapi"
+)
+
+// fakeInstruments справочник инструментов, который считает запросы полного списка акций
+type fakeInstruments struct {
+	api.InstrumentsServiceClient
+
+	sharesCalls int32
+}
+
+func (f *fakeInstruments) Shares(context.Context, *api.InstrumentsRequest, ...grpc.CallOption) (*api.SharesResponse, error) {
+	atomic.AddInt32(&f.sharesCalls, 1)
+	time.Sleep(20 * time.Millisecond) // долгий запрос, чтобы остальные обращения успели прийти к пустому справочнику
+	return &api.SharesResponse{Instruments: []*api.Share{{Figi: "FIGI", Ticker: "TICKER", Lot: 10}}}, nil
+}
+
+func (f *fakeInstruments) Etfs(context.Context, *api.InstrumentsRequest, ...grpc.CallOption) (*api.EtfsResponse, error) {
+	return &api.EtfsResponse{}, nil
+}
+
+func (f *fakeInstruments) Bonds(context.Context, *api.InstrumentsRequest, ...grpc.CallOption) (*api.BondsResponse, error) {
+	return &api.BondsResponse{}, nil
+}
+
+func (f *fakeInstruments) Futures(context.Context, *api.InstrumentsRequest, ...grpc.CallOption) (*api.FuturesResponse, error) {
+	return &api.FuturesResponse{}, nil
+}
+
+func (f *fakeInstruments) Currencies(context.Context, *api.InstrumentsRequest, ...grpc.CallOption) (*api.CurrenciesResponse, error) {
+	return &api.CurrenciesResponse{}, nil
+}
+
+func TestInstrumentsCacheLoadsOnce(t *testing.T) {
+	instruments := &fakeInstruments{}
+	s := &SDK{ctx: context.Background(), instruments: instruments}
+	cache := NewInstrumentsCache(s, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := cache.GetByTicker("TICKER")
+			if err != nil || len(found) != 1 {
+				t.Errorf("GetByTicker = %v, %v", found, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&instruments.sharesCalls); calls != 1 {
+		t.Fatalf("instruments were loaded %d times, want 1", calls)
+	}
+}
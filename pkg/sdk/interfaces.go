@@ -9,3 +9,29 @@ type MarketDataConsumer interface {
 	// Consume будет вызываться для каждого нового сообщения из стрима MarketDataStream
 	Consume(data *api.MarketDataResponse)
 }
+
+// TradesConsumer интерфейс получателя информации об обезличенных сделках (ленты сделок)
+type TradesConsumer interface {
+	// ConsumeTrade будет вызываться для каждой новой сделки из стрима MarketDataStream
+	ConsumeTrade(trade *api.Trade)
+}
+
+// TradingStatusConsumer интерфейс получателя информации об изменении торгового статуса инструмента
+type TradingStatusConsumer interface {
+	// ConsumeTradingStatus будет вызываться при каждом изменении торгового статуса из стрима MarketDataStream
+	ConsumeTradingStatus(status *api.TradingStatus)
+}
+
+// OrderTradesConsumer интерфейс получателя информации об исполнении собственных заявок
+type OrderTradesConsumer interface {
+	// ConsumeOrderTrades будет вызываться для каждого отчёта об исполнении из стрима TradesStream
+	ConsumeOrderTrades(orderTrades *api.OrderTrades)
+}
+
+// StreamEventsConsumer интерфейс получателя событий о состоянии стрима MarketDataStream
+type StreamEventsConsumer interface {
+	// StreamDisconnected будет вызываться при обрыве стрима, до начала переподключения
+	StreamDisconnected(err error)
+	// StreamReconnected будет вызываться после переоткрытия стрима и восстановления всех подписок
+	StreamReconnected()
+}
@@ -40,3 +40,8 @@ func IntervalToDuration(s string) time.Duration {
 		panic(fmt.Sprintf("Значение \"%s\" для интервала свечи не определено, есть только %s", s, Intervals))
 	}
 }
+
+// IntervalToMaxRequestPeriod максимальный период, за который GetCandles отдаёт свечи этого интервала за один запрос
+func IntervalToMaxRequestPeriod(s string) time.Duration {
+	return CandleIntervalToMaxRequestPeriod(IntervalToCandleInterval(s))
+}
@@ -2,6 +2,7 @@ package sdk
 
 import (
 	"tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
 )
 
 func QuotationToFloat(q *investapi.Quotation) float64 {
@@ -11,3 +12,30 @@ func QuotationToFloat(q *investapi.Quotation) float64 {
 func MoneyValueToFloat(q *investapi.MoneyValue) float64 {
 	return float64(q.Units) + float64(q.Nano)/1000000000
 }
+
+// QuotationToDecimal переводит Quotation в Decimal без потери точности, nil считается нулём
+func QuotationToDecimal(q *investapi.Quotation) decimal.Decimal {
+	return decimal.New(q.GetUnits(), q.GetNano())
+}
+
+// MoneyValueToDecimal переводит MoneyValue в Decimal без потери точности, валюта отбрасывается
+func MoneyValueToDecimal(m *investapi.MoneyValue) decimal.Decimal {
+	return decimal.New(m.GetUnits(), m.GetNano())
+}
+
+// DecimalToQuotation переводит Decimal в Quotation без потери точности
+func DecimalToQuotation(d decimal.Decimal) *investapi.Quotation {
+	return &investapi.Quotation{
+		Units: d.Units(),
+		Nano:  d.Nano(),
+	}
+}
+
+// DecimalToMoneyValue переводит Decimal в MoneyValue в указанной валюте без потери точности
+func DecimalToMoneyValue(d decimal.Decimal, currency string) *investapi.MoneyValue {
+	return &investapi.MoneyValue{
+		Currency: currency,
+		Units:    d.Units(),
+		Nano:     d.Nano(),
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	api "tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
 )
 
 // GetShares возвращает список доступных акций для торговли
@@ -33,6 +34,98 @@ func (s *SDK) GetShares() ([]*api.Share, string, error) {
 	return r.GetInstruments(), trackingId, nil
 }
 
+// GetEtfs возвращает список доступных для торговли фондов (ETF)
+func (s *SDK) GetEtfs() ([]*api.Etf, string, error) {
+	var header, trailer metadata.MD
+	r, err := s.instruments.Etfs(
+		s.ctx,
+		&api.InstrumentsRequest{
+			InstrumentStatus: api.InstrumentStatus_INSTRUMENT_STATUS_BASE, // only base is accessible for trading via api
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return r.GetInstruments(), trackingId, nil
+}
+
+// GetBonds возвращает список доступных для торговли облигаций
+func (s *SDK) GetBonds() ([]*api.Bond, string, error) {
+	var header, trailer metadata.MD
+	r, err := s.instruments.Bonds(
+		s.ctx,
+		&api.InstrumentsRequest{
+			InstrumentStatus: api.InstrumentStatus_INSTRUMENT_STATUS_BASE, // only base is accessible for trading via api
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return r.GetInstruments(), trackingId, nil
+}
+
+// GetFutures возвращает список доступных для торговли фьючерсов
+func (s *SDK) GetFutures() ([]*api.Future, string, error) {
+	var header, trailer metadata.MD
+	r, err := s.instruments.Futures(
+		s.ctx,
+		&api.InstrumentsRequest{
+			InstrumentStatus: api.InstrumentStatus_INSTRUMENT_STATUS_BASE, // only base is accessible for trading via api
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return r.GetInstruments(), trackingId, nil
+}
+
+// GetCurrencies возвращает список доступных для торговли валют
+func (s *SDK) GetCurrencies() ([]*api.Currency, string, error) {
+	var header, trailer metadata.MD
+	r, err := s.instruments.Currencies(
+		s.ctx,
+		&api.InstrumentsRequest{
+			InstrumentStatus: api.InstrumentStatus_INSTRUMENT_STATUS_BASE, // only base is accessible for trading via api
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return r.GetInstruments(), trackingId, nil
+}
+
 // GetInstrumentByFigi возвращает информацию об инструменте по figi
 func (s *SDK) GetInstrumentByFigi(figi string) (*api.Instrument, string, error) {
 	var header, trailer metadata.MD
@@ -52,6 +145,29 @@ func (s *SDK) GetInstrumentByFigi(figi string) (*api.Instrument, string, error)
 	return r.GetInstrument(), trackingId, nil
 }
 
+// GetFuturesMargin возвращает размер гарантийного обеспечения по фьючерсу
+func (s *SDK) GetFuturesMargin(figi string) (*api.GetFuturesMarginResponse, string, error) {
+	var header, trailer metadata.MD
+	r, err := s.instruments.GetFuturesMargin(
+		s.ctx,
+		&api.GetFuturesMarginRequest{
+			Figi: figi,
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return r, trackingId, nil
+}
+
 // GetLastPrices позволяет узнать последнюю цену для акций
 func (s *SDK) GetLastPrices(figi []string) ([]*api.LastPrice, string, error) {
 	// figi it's id of share, looks like "BBG002293PJ4"
@@ -159,6 +275,27 @@ func (s *SDK) GetOrderBook(figi string, depth int32) (*api.GetOrderBookResponse,
 	return r, trackingId, nil
 }
 
+// GetTradingStatus возвращает текущий торговый статус инструмента по figi
+func (s *SDK) GetTradingStatus(figi string) (*api.GetTradingStatusResponse, string, error) {
+	var header, trailer metadata.MD
+	r, err := s.marketData.GetTradingStatus(
+		s.ctx,
+		&api.GetTradingStatusRequest{Figi: figi},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return r, trackingId, nil
+}
+
 // GetAccounts возвращает аккаунты, к которым есть доступ по текущему токену
 func (s *SDK) GetAccounts() ([]*api.Account, string, error) {
 	var header, trailer metadata.MD
@@ -272,15 +409,25 @@ func (s *SDK) GetPortfolio(accountId string) (*api.PortfolioResponse, string, er
 
 // RealMarketBuy выставляет ордер на покупку покупку инструмента по figi и аккаунту
 func (s *SDK) RealMarketBuy(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
-	return s.postMarketOrder(figi, quantity, api.OrderDirection_ORDER_DIRECTION_BUY, accountId, orderId)
+	return s.postOrder(figi, quantity, nil, api.OrderDirection_ORDER_DIRECTION_BUY, accountId, api.OrderType_ORDER_TYPE_MARKET, orderId)
 }
 
 // RealMarketSell выставляет ордер на продажу инструмента по figi и аккаунту
 func (s *SDK) RealMarketSell(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
-	return s.postMarketOrder(figi, quantity, api.OrderDirection_ORDER_DIRECTION_SELL, accountId, orderId)
+	return s.postOrder(figi, quantity, nil, api.OrderDirection_ORDER_DIRECTION_SELL, accountId, api.OrderType_ORDER_TYPE_MARKET, orderId)
 }
 
-func (s *SDK) postMarketOrder(figi string, quantity int64, direction api.OrderDirection, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+// RealLimitBuy выставляет лимитную заявку на покупку инструмента по цене price за 1 инструмент
+func (s *SDK) RealLimitBuy(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return s.postOrder(figi, quantity, DecimalToQuotation(price), api.OrderDirection_ORDER_DIRECTION_BUY, accountId, api.OrderType_ORDER_TYPE_LIMIT, orderId)
+}
+
+// RealLimitSell выставляет лимитную заявку на продажу инструмента по цене price за 1 инструмент
+func (s *SDK) RealLimitSell(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return s.postOrder(figi, quantity, DecimalToQuotation(price), api.OrderDirection_ORDER_DIRECTION_SELL, accountId, api.OrderType_ORDER_TYPE_LIMIT, orderId)
+}
+
+func (s *SDK) postOrder(figi string, quantity int64, price *api.Quotation, direction api.OrderDirection, accountId string, orderType api.OrderType, orderId string) (*api.PostOrderResponse, string, error) {
 	var header, trailer metadata.MD
 
 	resp, err := s.orders.PostOrder(
@@ -288,10 +435,10 @@ func (s *SDK) postMarketOrder(figi string, quantity int64, direction api.OrderDi
 		&api.PostOrderRequest{
 			Figi:      figi,
 			Quantity:  quantity,
-			Price:     nil,
+			Price:     price,
 			Direction: direction,
 			AccountId: accountId,
-			OrderType: api.OrderType_ORDER_TYPE_MARKET,
+			OrderType: orderType,
 			OrderId:   orderId,
 		},
 		grpc.Header(&header),
@@ -309,6 +456,78 @@ func (s *SDK) postMarketOrder(figi string, quantity int64, direction api.OrderDi
 	return resp, trackingId, nil
 }
 
+// CancelOrder отменяет выставленную заявку, orderId это идентификатор заявки на бирже из PostOrderResponse
+func (s *SDK) CancelOrder(accountId string, orderId string) (*api.CancelOrderResponse, string, error) {
+	var header, trailer metadata.MD
+
+	resp, err := s.orders.CancelOrder(
+		s.ctx,
+		&api.CancelOrderRequest{
+			AccountId: accountId,
+			OrderId:   orderId,
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return resp, trackingId, nil
+}
+
+// GetOrderState возвращает текущее состояние заявки
+func (s *SDK) GetOrderState(accountId string, orderId string) (*api.OrderState, string, error) {
+	var header, trailer metadata.MD
+
+	resp, err := s.orders.GetOrderState(
+		s.ctx,
+		&api.GetOrderStateRequest{
+			AccountId: accountId,
+			OrderId:   orderId,
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return resp, trackingId, nil
+}
+
+// GetOrders возвращает все активные заявки аккаунта
+func (s *SDK) GetOrders(accountId string) ([]*api.OrderState, string, error) {
+	var header, trailer metadata.MD
+
+	resp, err := s.orders.GetOrders(
+		s.ctx,
+		&api.GetOrdersRequest{AccountId: accountId},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return resp.GetOrders(), trackingId, nil
+}
+
 // GetPositions получает все активные позиции аккаунта
 func (s *SDK) GetPositions(accountId string) (*api.PositionsResponse, string, error) {
 	var header, trailer metadata.MD
@@ -0,0 +1,182 @@
+package sdk
+
+import (
+	"context"
+	"time"
+
+	api "tinkoff-invest-bot/investapi"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// AddStreamEventsConsumer Подписать консьюмера на события обрыва и восстановления стрима
+func (s *SDK) AddStreamEventsConsumer(consumer *StreamEventsConsumer) {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+	s.eventsConsumers = append(s.eventsConsumers, consumer)
+}
+
+// stream возвращает текущий стрим, он может быть пересоздан при переподключении
+func (s *SDK) stream() api.MarketDataStreamService_MarketDataStreamClient {
+	s.streamMu.Lock()
+	defer s.streamMu.Unlock()
+	return s.marketDataStreamClient
+}
+
+// send отправляет запрос в текущий стрим
+func (s *SDK) send(request *api.MarketDataRequest) error {
+	s.streamMu.Lock()
+	defer s.streamMu.Unlock()
+	return s.marketDataStreamClient.Send(request)
+}
+
+// reconnect переоткрывает стрим с экспоненциально растущей задержкой и повторяет все активные подписки.
+// Возвращает false, если SDK был остановлен раньше, чем удалось переподключиться
+func (s *SDK) reconnect() bool {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-s.ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		if err := s.reopenStream(); err == nil {
+			return true
+		}
+
+		delay = nextReconnectDelay(delay)
+	}
+}
+
+// nextReconnectDelay увеличивает задержку перед следующей попыткой переподключения
+func nextReconnectDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > maxReconnectDelay {
+		return maxReconnectDelay
+	}
+	return delay
+}
+
+// reopenStream создаёт новый стрим, отправляет в него все активные подписки и закрывает старый стрим.
+// Блокировки берутся в том же порядке, что и при подписке: сначала реестр, потом стрим
+func (s *SDK) reopenStream() error {
+	s.registryMu.RLock()
+	defer s.registryMu.RUnlock()
+	s.streamMu.Lock()
+	defer s.streamMu.Unlock()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	stream, err := s.marketDataStream.MarketDataStream(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	for _, request := range s.activeSubscriptions() {
+		if err := stream.Send(request); err != nil {
+			_ = stream.CloseSend()
+			cancel()
+			return err
+		}
+	}
+
+	if s.marketDataStreamClient != nil {
+		_ = s.marketDataStreamClient.CloseSend()
+	}
+	if s.streamCancel != nil {
+		s.streamCancel()
+	}
+	s.marketDataStreamClient, s.streamCancel = stream, cancel
+	return nil
+}
+
+// activeSubscriptions вызывается под registryMu и собирает запросы на подписку для всех консьюмеров, которые сейчас подписаны
+func (s *SDK) activeSubscriptions() []*api.MarketDataRequest {
+	var requests []*api.MarketDataRequest
+
+	if len(s.candlesConsumers) > 0 {
+		instruments := make([]*api.CandleInstrument, 0, len(s.candlesConsumers))
+		for key := range s.candlesConsumers {
+			instruments = append(instruments, &api.CandleInstrument{Figi: key.figi, Interval: key.interval})
+		}
+		requests = append(requests, &api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeCandlesRequest{
+				SubscribeCandlesRequest: &api.SubscribeCandlesRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE,
+					Instruments:        instruments,
+				},
+			},
+		})
+	}
+
+	if len(s.orderBookConsumers) > 0 {
+		instruments := make([]*api.OrderBookInstrument, 0, len(s.orderBookConsumers))
+		for key := range s.orderBookConsumers {
+			instruments = append(instruments, &api.OrderBookInstrument{Figi: key.figi, Depth: key.depth})
+		}
+		requests = append(requests, &api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeOrderBookRequest{
+				SubscribeOrderBookRequest: &api.SubscribeOrderBookRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE,
+					Instruments:        instruments,
+				},
+			},
+		})
+	}
+
+	if len(s.tradesConsumers) > 0 {
+		instruments := make([]*api.TradeInstrument, 0, len(s.tradesConsumers))
+		for figi := range s.tradesConsumers {
+			instruments = append(instruments, &api.TradeInstrument{Figi: figi})
+		}
+		requests = append(requests, &api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeTradesRequest{
+				SubscribeTradesRequest: &api.SubscribeTradesRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE,
+					Instruments:        instruments,
+				},
+			},
+		})
+	}
+
+	if len(s.infoConsumers) > 0 {
+		instruments := make([]*api.InfoInstrument, 0, len(s.infoConsumers))
+		for figi := range s.infoConsumers {
+			instruments = append(instruments, &api.InfoInstrument{Figi: figi})
+		}
+		requests = append(requests, &api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeInfoRequest{
+				SubscribeInfoRequest: &api.SubscribeInfoRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE,
+					Instruments:        instruments,
+				},
+			},
+		})
+	}
+
+	return requests
+}
+
+func (s *SDK) notifyDisconnected(err error) {
+	for _, consumer := range s.streamEventsConsumers() {
+		(*consumer).StreamDisconnected(err)
+	}
+}
+
+func (s *SDK) notifyReconnected() {
+	for _, consumer := range s.streamEventsConsumers() {
+		(*consumer).StreamReconnected()
+	}
+}
+
+// streamEventsConsumers копия списка, чтобы консьюмеры вызывались без удержания блокировки
+func (s *SDK) streamEventsConsumers() []*StreamEventsConsumer {
+	s.registryMu.RLock()
+	defer s.registryMu.RUnlock()
+	consumers := make([]*StreamEventsConsumer, len(s.eventsConsumers))
+	copy(consumers, s.eventsConsumers)
+	return consumers
+}
@@ -1,10 +1,14 @@
 package sdk
 
 import (
+	"time"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	api "tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
 )
 
 // GetSandboxAccounts Получает все Sandbox аккаунты
@@ -28,17 +32,27 @@ func (s *SDK) GetSandboxAccounts() ([]*api.Account, string, error) {
 	return resp.Accounts, trackingId, nil
 }
 
-// SandboxMarketSell выставляет ордер на покупку акции в Sandbox
+// SandboxMarketBuy выставляет ордер на покупку акции в Sandbox
 func (s *SDK) SandboxMarketBuy(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
-	return s.postSandboxMarketOrder(figi, quantity, api.OrderDirection_ORDER_DIRECTION_BUY, accountId, orderId)
+	return s.postSandboxOrder(figi, quantity, nil, api.OrderDirection_ORDER_DIRECTION_BUY, accountId, api.OrderType_ORDER_TYPE_MARKET, orderId)
 }
 
 // SandboxMarketSell выставляет ордер на продажу акции в Sandbox
 func (s *SDK) SandboxMarketSell(figi string, quantity int64, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
-	return s.postSandboxMarketOrder(figi, quantity, api.OrderDirection_ORDER_DIRECTION_SELL, accountId, orderId)
+	return s.postSandboxOrder(figi, quantity, nil, api.OrderDirection_ORDER_DIRECTION_SELL, accountId, api.OrderType_ORDER_TYPE_MARKET, orderId)
+}
+
+// SandboxLimitBuy выставляет лимитную заявку на покупку в Sandbox по цене price за 1 инструмент
+func (s *SDK) SandboxLimitBuy(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return s.postSandboxOrder(figi, quantity, DecimalToQuotation(price), api.OrderDirection_ORDER_DIRECTION_BUY, accountId, api.OrderType_ORDER_TYPE_LIMIT, orderId)
 }
 
-func (s *SDK) postSandboxMarketOrder(figi string, quantity int64, direction api.OrderDirection, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+// SandboxLimitSell выставляет лимитную заявку на продажу в Sandbox по цене price за 1 инструмент
+func (s *SDK) SandboxLimitSell(figi string, quantity int64, price decimal.Decimal, accountId string, orderId string) (*api.PostOrderResponse, string, error) {
+	return s.postSandboxOrder(figi, quantity, DecimalToQuotation(price), api.OrderDirection_ORDER_DIRECTION_SELL, accountId, api.OrderType_ORDER_TYPE_LIMIT, orderId)
+}
+
+func (s *SDK) postSandboxOrder(figi string, quantity int64, price *api.Quotation, direction api.OrderDirection, accountId string, orderType api.OrderType, orderId string) (*api.PostOrderResponse, string, error) {
 	var header, trailer metadata.MD
 
 	resp, err := s.sandbox.PostSandboxOrder(
@@ -46,10 +60,60 @@ func (s *SDK) postSandboxMarketOrder(figi string, quantity int64, direction api.
 		&api.PostOrderRequest{
 			Figi:      figi,
 			Quantity:  quantity,
-			Price:     nil,
+			Price:     price,
 			Direction: direction,
 			AccountId: accountId,
-			OrderType: api.OrderType_ORDER_TYPE_MARKET,
+			OrderType: orderType,
+			OrderId:   orderId,
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return resp, trackingId, nil
+}
+
+// CancelSandboxOrder отменяет выставленную заявку в Sandbox
+func (s *SDK) CancelSandboxOrder(accountId string, orderId string) (*api.CancelOrderResponse, string, error) {
+	var header, trailer metadata.MD
+
+	resp, err := s.sandbox.CancelSandboxOrder(
+		s.ctx,
+		&api.CancelOrderRequest{
+			AccountId: accountId,
+			OrderId:   orderId,
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return resp, trackingId, nil
+}
+
+// GetSandboxOrderState возвращает текущее состояние заявки в Sandbox
+func (s *SDK) GetSandboxOrderState(accountId string, orderId string) (*api.OrderState, string, error) {
+	var header, trailer metadata.MD
+
+	resp, err := s.sandbox.GetSandboxOrderState(
+		s.ctx,
+		&api.GetOrderStateRequest{
+			AccountId: accountId,
 			OrderId:   orderId,
 		},
 		grpc.Header(&header),
@@ -67,6 +131,28 @@ func (s *SDK) postSandboxMarketOrder(figi string, quantity int64, direction api.
 	return resp, trackingId, nil
 }
 
+// GetSandboxOrders возвращает все активные заявки Sandbox аккаунта
+func (s *SDK) GetSandboxOrders(accountId string) ([]*api.OrderState, string, error) {
+	var header, trailer metadata.MD
+
+	resp, err := s.sandbox.GetSandboxOrders(
+		s.ctx,
+		&api.GetOrdersRequest{AccountId: accountId},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return resp.GetOrders(), trackingId, nil
+}
+
 // GetSandboxPositions Получает все активные позиции Sandbox аккаунта
 func (s *SDK) GetSandboxPositions(accountId string) (*api.PositionsResponse, string, error) {
 	var header, trailer metadata.MD
@@ -111,3 +197,30 @@ func (s *SDK) GetSandboxPortfolio(accountId string) (*api.PortfolioResponse, str
 	}
 	return resp, trackingId, nil
 }
+
+// GetSandboxOperations возвращает операции, выполненные на Sandbox аккаунте за указанный период
+func (s *SDK) GetSandboxOperations(accountId string, from time.Time, to time.Time, figi string) ([]*api.Operation, string, error) {
+	var header, trailer metadata.MD
+
+	r, err := s.sandbox.GetSandboxOperations(
+		s.ctx,
+		&api.OperationsRequest{
+			AccountId: accountId,
+			From:      timestamppb.New(from),
+			To:        timestamppb.New(to),
+			Figi:      figi,
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return r.GetOperations(), trackingId, nil
+}
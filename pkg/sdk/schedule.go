@@ -0,0 +1,106 @@
+package sdk
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	api "tinkoff-invest-bot/investapi"
+)
+
+// TradingSession непрерывный интервал торгов на площадке: основная или вечерняя сессия одного дня
+type TradingSession struct {
+	Exchange string
+	Start    time.Time
+	End      time.Time
+}
+
+// Contains идёт ли сессия в момент t
+func (s TradingSession) Contains(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// GetTradingSchedules возвращает расписание торгов площадки по дням за период [from, to].
+// Пустой exchange вернёт расписания всех площадок
+func (s *SDK) GetTradingSchedules(exchange string, from time.Time, to time.Time) ([]*api.TradingSchedule, string, error) {
+	var header, trailer metadata.MD
+	resp, err := s.instruments.TradingSchedules(
+		s.ctx, &api.TradingSchedulesRequest{
+			From:     timestamppb.New(from.UTC()),
+			To:       timestamppb.New(to.UTC()),
+			Exchange: exchange,
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return resp.GetExchanges(), trackingId, nil
+}
+
+// GetTradingSessions возвращает торговые сессии площадки за период [from, to], отсортированные по времени начала
+func (s *SDK) GetTradingSessions(exchange string, from time.Time, to time.Time) ([]TradingSession, string, error) {
+	schedules, trackingId, err := s.GetTradingSchedules(exchange, from, to)
+	if err != nil {
+		return nil, trackingId, err
+	}
+	return TradingSessions(schedules, exchange), trackingId, nil
+}
+
+// TradingSessions собирает торговые сессии из расписания: основную и вечернюю сессию каждого торгового дня.
+// Если в расписании есть площадка с именем exchange, берутся только её дни, иначе дни всех площадок
+func TradingSessions(schedules []*api.TradingSchedule, exchange string) []TradingSession {
+	var matched []*api.TradingSchedule
+	for _, schedule := range schedules {
+		if strings.EqualFold(schedule.GetExchange(), exchange) {
+			matched = append(matched, schedule)
+		}
+	}
+	if len(matched) == 0 {
+		matched = schedules
+	}
+
+	var sessions []TradingSession
+	for _, schedule := range matched {
+		for _, day := range schedule.GetDays() {
+			if !day.GetIsTradingDay() {
+				continue
+			}
+			if session, ok := newTradingSession(schedule.GetExchange(), day.GetStartTime(), day.GetEndTime()); ok {
+				sessions = append(sessions, session)
+			}
+			if session, ok := newTradingSession(schedule.GetExchange(), day.GetEveningStartTime(), day.GetEveningEndTime()); ok {
+				sessions = append(sessions, session)
+			}
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+	return sessions
+}
+
+func newTradingSession(exchange string, start *timestamppb.Timestamp, end *timestamppb.Timestamp) (TradingSession, bool) {
+	if start == nil || end == nil {
+		return TradingSession{}, false
+	}
+	session := TradingSession{
+		Exchange: exchange,
+		Start:    start.AsTime(),
+		End:      end.AsTime(),
+	}
+	if session.Start.Unix() <= 0 || !session.Start.Before(session.End) {
+		return TradingSession{}, false
+	}
+	return session, true
+}
@@ -4,8 +4,9 @@ import (
 	"context"
 	"crypto/tls"
 	"io"
-	"log"
+	"sync"
 
+	"go.uber.org/zap"
 	"golang.org/x/xerrors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -23,13 +24,42 @@ type SDK struct {
 	marketDataStream api.MarketDataStreamServiceClient
 	operations       api.OperationsServiceClient
 	orders           api.OrdersServiceClient
+	ordersStream     api.OrdersStreamServiceClient
 	sandbox          api.SandboxServiceClient
 	stopOrders       api.StopOrdersServiceClient
 	users            api.UsersServiceClient
 
+	streamMu               sync.Mutex // защищает пересоздание стрима и отправку в него сообщений
 	marketDataStreamClient api.MarketDataStreamService_MarketDataStreamClient
+	streamCancel           context.CancelFunc // отменяет контекст текущего стрима, чтобы освободить его при переподключении
 
-	candlesConsumers map[string][]*MarketDataConsumer
+	registryMu         sync.RWMutex // защищает все реестры консьюмеров ниже
+	eventsConsumers    []*StreamEventsConsumer
+	candlesConsumers   map[candlesKey][]*subscriber
+	orderBookConsumers map[orderBookKey][]*subscriber
+	tradesConsumers    map[string][]*subscriber
+	infoConsumers      map[string][]*subscriber
+
+	fillsMu        sync.Mutex // защищает подписки на исполнение заявок
+	fillsConsumers map[fillsKey][]*OrderTradesConsumer
+	fillsStreams   map[string]context.CancelFunc // открытые стримы TradesStream по аккаунтам
+
+	instrumentsCache *InstrumentsCache
+	history          *HistoryService
+
+	logger *zap.Logger
+}
+
+// candlesKey ключ подписки на свечи, на один figi можно подписаться с разными интервалами
+type candlesKey struct {
+	figi     string
+	interval api.SubscriptionInterval
+}
+
+// orderBookKey ключ подписки на стакан, у одного figi может быть несколько подписок с разной глубиной
+type orderBookKey struct {
+	figi  string
+	depth int32
 }
 
 // New создаёт новый инстанс SDK
@@ -47,12 +77,14 @@ func New(address string, token string, appName string, ctx context.Context) (*SD
 	ctx = prepareOutgoingContext(ctx, token, appName)
 
 	marketDataStream := api.NewMarketDataStreamServiceClient(conn)
-	stream, err := marketDataStream.MarketDataStream(ctx)
+	streamCtx, streamCancel := context.WithCancel(ctx)
+	stream, err := marketDataStream.MarketDataStream(streamCtx)
 	if err != nil {
+		streamCancel()
 		return nil, xerrors.Errorf("can't careate market date stream: %v", err)
 	}
 
-	return &SDK{
+	s := &SDK{
 		ctx:  ctx,
 		conn: conn,
 
@@ -61,39 +93,58 @@ func New(address string, token string, appName string, ctx context.Context) (*SD
 		marketDataStream: marketDataStream,
 		operations:       api.NewOperationsServiceClient(conn),
 		orders:           api.NewOrdersServiceClient(conn),
+		ordersStream:     api.NewOrdersStreamServiceClient(conn),
 		sandbox:          api.NewSandboxServiceClient(conn),
 		stopOrders:       api.NewStopOrdersServiceClient(conn),
 		users:            api.NewUsersServiceClient(conn),
 
 		marketDataStreamClient: stream,
+		streamCancel:           streamCancel,
+
+		candlesConsumers:   make(map[candlesKey][]*subscriber, 0),
+		orderBookConsumers: make(map[orderBookKey][]*subscriber, 0),
+		tradesConsumers:    make(map[string][]*subscriber, 0),
+		infoConsumers:      make(map[string][]*subscriber, 0),
+
+		fillsConsumers: make(map[fillsKey][]*OrderTradesConsumer, 0),
+		fillsStreams:   make(map[string]context.CancelFunc, 0),
 
-		candlesConsumers: make(map[string][]*MarketDataConsumer, 0),
-	}, nil
+		logger: zap.NewNop(),
+	}
+	s.instrumentsCache = NewInstrumentsCache(s, DefaultInstrumentsRefreshInterval)
+	s.history = NewHistoryService(s, DefaultHistoryCacheDir)
+	return s, nil
+}
+
+// SetLogger задаёт логгер для сообщений SDK, например о переполненных очередях консьюмеров.
+// Вызывается до первой подписки, по умолчанию сообщения не логируются
+func (s *SDK) SetLogger(logger *zap.Logger) {
+	s.logger = logger
 }
 
 // Run запускает двунаправленный стрим для получения информации
-// Новую информацию об акции скармливает нужному консьюмеру
+// Новую информацию об акции скармливает нужному консьюмеру.
+// При обрыве стрим переоткрывается автоматически, все активные подписки восстанавливаются
 func (s *SDK) Run() {
 	go func() {
 		for {
-			newMessage, err := s.marketDataStreamClient.Recv()
-			if err == io.EOF {
-				log.Fatalf("Data stream closed. No more data.")
-				return
-			}
+			newMessage, err := s.stream().Recv()
 			if err != nil {
-				log.Fatalf("Failed to receive new message : %v", err)
-			}
-
-			if newMessage != nil && newMessage.GetCandle() != nil { // notify candles subscribers
-				figi := newMessage.GetCandle().GetFigi()
-				figiConsumers, contains := s.candlesConsumers[figi]
-				if contains {
-					for _, consumer := range figiConsumers {
-						(*consumer).Consume(newMessage)
-					}
+				if s.ctx.Err() != nil { // SDK остановлен, переподключаться не нужно
+					return
+				}
+				if err == io.EOF {
+					err = xerrors.Errorf("market data stream closed by server")
 				}
+				s.notifyDisconnected(err)
+				if !s.reconnect() {
+					return
+				}
+				s.notifyReconnected()
+				continue
 			}
+
+			s.dispatch(newMessage)
 		}
 	}()
 }
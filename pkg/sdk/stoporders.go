@@ -0,0 +1,93 @@
+package sdk
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	api "tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+)
+
+// PostStopOrder выставляет бессрочную стоп-заявку, возвращает её идентификатор.
+// price это цена исполнения для stop-limit заявки, для take-profit и stop-loss она не используется
+func (s *SDK) PostStopOrder(figi string, quantity int64, price decimal.Decimal, stopPrice decimal.Decimal, direction api.StopOrderDirection, stopOrderType api.StopOrderType, accountId string) (string, string, error) {
+	var header, trailer metadata.MD
+
+	var limitPrice *api.Quotation
+	if stopOrderType == api.StopOrderType_STOP_ORDER_TYPE_STOP_LIMIT {
+		limitPrice = DecimalToQuotation(price)
+	}
+
+	resp, err := s.stopOrders.PostStopOrder(
+		s.ctx,
+		&api.PostStopOrderRequest{
+			Figi:           figi,
+			Quantity:       quantity,
+			Price:          limitPrice,
+			StopPrice:      DecimalToQuotation(stopPrice),
+			Direction:      direction,
+			AccountId:      accountId,
+			ExpirationType: api.StopOrderExpirationType_STOP_ORDER_EXPIRATION_TYPE_GOOD_TILL_CANCEL,
+			StopOrderType:  stopOrderType,
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return "", trackingId, extractedError
+		}
+		return "", trackingId, err
+	}
+	return resp.GetStopOrderId(), trackingId, nil
+}
+
+// GetStopOrders возвращает все активные стоп-заявки аккаунта
+func (s *SDK) GetStopOrders(accountId string) ([]*api.StopOrder, string, error) {
+	var header, trailer metadata.MD
+
+	resp, err := s.stopOrders.GetStopOrders(
+		s.ctx,
+		&api.GetStopOrdersRequest{AccountId: accountId},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return resp.GetStopOrders(), trackingId, nil
+}
+
+// CancelStopOrder отменяет стоп-заявку по её идентификатору
+func (s *SDK) CancelStopOrder(accountId string, stopOrderId string) (*api.CancelStopOrderResponse, string, error) {
+	var header, trailer metadata.MD
+
+	resp, err := s.stopOrders.CancelStopOrder(
+		s.ctx,
+		&api.CancelStopOrderRequest{
+			AccountId:   accountId,
+			StopOrderId: stopOrderId,
+		},
+		grpc.Header(&header),
+		grpc.Trailer(&trailer),
+	)
+
+	trackingId := extractTrackingId(&header, &trailer)
+
+	if err != nil {
+		if extractedError := extractRequestError(&trailer); extractedError != nil {
+			return nil, trackingId, extractedError
+		}
+		return nil, trackingId, err
+	}
+	return resp, trackingId, nil
+}
@@ -1,14 +1,35 @@
 package sdk
 
 import (
+	"go.uber.org/zap"
 	"golang.org/x/xerrors"
 
 	api "tinkoff-invest-bot/investapi"
 )
 
-// SubscribeCandles Подписать консьюмера на информацию о новых свечах
+// Все методы подписки безопасно вызывать из разных горутин.
+// Запрос в стрим отправляется только при первой подписке на инструмент и при отписке последнего консьюмера
+
+// sendSubscribe вызывается под registryMu после того, как консьюмер добавлен в реестр. Если стрим оборван,
+// запрос не уходит, но подписка повторится при переподключении вместе с остальными активными подписками
+func (s *SDK) sendSubscribe(request *api.MarketDataRequest, figi string) {
+	if err := s.send(request); err != nil {
+		s.logger.Warn("Can't send subscription request, it will be repeated after reconnect", zap.String("figi", figi), zap.Error(err))
+	}
+}
+
+// SubscribeCandles Подписать консьюмера на информацию о новых свечах инструмента с указанным интервалом
 func (s *SDK) SubscribeCandles(figi string, interval api.SubscriptionInterval, consumer *MarketDataConsumer) error {
-	consumers, contains := s.candlesConsumers[figi]
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	key := candlesKey{figi: figi, interval: interval}
+	consumers, contains := s.candlesConsumers[key]
+	sub := newSubscriber(consumer, s.logger, func(message *api.MarketDataResponse) {
+		(*consumer).Consume(message)
+	})
+	s.candlesConsumers[key] = append(consumers, sub)
+
 	if !contains {
 		subscribeRequest := api.MarketDataRequest{
 			Payload: &api.MarketDataRequest_SubscribeCandlesRequest{
@@ -23,46 +44,224 @@ func (s *SDK) SubscribeCandles(figi string, interval api.SubscriptionInterval, c
 				},
 			},
 		}
-		if err := s.marketDataStreamClient.Send(&subscribeRequest); err != nil {
+		s.sendSubscribe(&subscribeRequest, figi)
+	}
+	return nil
+}
+
+// UnsubscribeCandles Отписать консьюмера от информацию о новых свечах инструмента с указанным интервалом
+func (s *SDK) UnsubscribeCandles(figi string, interval api.SubscriptionInterval, consumer *MarketDataConsumer) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	key := candlesKey{figi: figi, interval: interval}
+	consumers, removed := removeSubscriber(s.candlesConsumers[key], consumer)
+	if !removed {
+		return xerrors.Errorf("no such consumer subscribed on figi %s with interval %s", figi, interval)
+	}
+	s.candlesConsumers[key] = consumers
+
+	if len(consumers) == 0 {
+		delete(s.candlesConsumers, key)
+
+		unsubscribeRequest := api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeCandlesRequest{
+				SubscribeCandlesRequest: &api.SubscribeCandlesRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_UNSUBSCRIBE,
+					Instruments: []*api.CandleInstrument{
+						{
+							Figi:     figi,
+							Interval: interval,
+						},
+					},
+				},
+			},
+		}
+		if err := s.send(&unsubscribeRequest); err != nil {
 			return err
 		}
-		s.candlesConsumers[figi] = make([]*MarketDataConsumer, 0)
 	}
+	return nil
+}
+
+// SubscribeOrderBook Подписать консьюмера на стакан инструмента указанной глубины
+func (s *SDK) SubscribeOrderBook(figi string, depth int32, consumer *MarketDataConsumer) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
 
-	s.candlesConsumers[figi] = append(consumers, consumer)
+	key := orderBookKey{figi: figi, depth: depth}
+	consumers, contains := s.orderBookConsumers[key]
+	sub := newSubscriber(consumer, s.logger, func(message *api.MarketDataResponse) {
+		(*consumer).Consume(message)
+	})
+	s.orderBookConsumers[key] = append(consumers, sub)
+
+	if !contains {
+		subscribeRequest := api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeOrderBookRequest{
+				SubscribeOrderBookRequest: &api.SubscribeOrderBookRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE,
+					Instruments: []*api.OrderBookInstrument{
+						{
+							Figi:  figi,
+							Depth: depth,
+						},
+					},
+				},
+			},
+		}
+		s.sendSubscribe(&subscribeRequest, figi)
+	}
+	return nil
+}
+
+// UnsubscribeOrderBook Отписать консьюмера от стакана инструмента указанной глубины
+func (s *SDK) UnsubscribeOrderBook(figi string, depth int32, consumer *MarketDataConsumer) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	key := orderBookKey{figi: figi, depth: depth}
+	consumers, removed := removeSubscriber(s.orderBookConsumers[key], consumer)
+	if !removed {
+		return xerrors.Errorf("no such consumer subscribed on order book %s with depth %d", figi, depth)
+	}
+	s.orderBookConsumers[key] = consumers
+
+	if len(consumers) == 0 {
+		delete(s.orderBookConsumers, key)
+
+		unsubscribeRequest := api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeOrderBookRequest{
+				SubscribeOrderBookRequest: &api.SubscribeOrderBookRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_UNSUBSCRIBE,
+					Instruments: []*api.OrderBookInstrument{
+						{
+							Figi:  figi,
+							Depth: depth,
+						},
+					},
+				},
+			},
+		}
+		if err := s.send(&unsubscribeRequest); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// UnsubscribeCandles Отписать консьюмера от информацию о новых свечах
-func (s *SDK) UnsubscribeCandles(figi string, consumer *MarketDataConsumer) error {
-	consumers, contains := s.candlesConsumers[figi]
+// SubscribeTrades Подписать консьюмера на ленту обезличенных сделок по инструменту
+func (s *SDK) SubscribeTrades(figi string, consumer *TradesConsumer) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	consumers, contains := s.tradesConsumers[figi]
+	sub := newSubscriber(consumer, s.logger, func(message *api.MarketDataResponse) {
+		(*consumer).ConsumeTrade(message.GetTrade())
+	})
+	s.tradesConsumers[figi] = append(consumers, sub)
+
 	if !contains {
-		return xerrors.Errorf("no such consumer subscribed on figi %s", figi)
+		subscribeRequest := api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeTradesRequest{
+				SubscribeTradesRequest: &api.SubscribeTradesRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE,
+					Instruments: []*api.TradeInstrument{
+						{Figi: figi},
+					},
+				},
+			},
+		}
+		s.sendSubscribe(&subscribeRequest, figi)
+	}
+	return nil
+}
+
+// UnsubscribeTrades Отписать консьюмера от ленты обезличенных сделок по инструменту
+func (s *SDK) UnsubscribeTrades(figi string, consumer *TradesConsumer) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	consumers, removed := removeSubscriber(s.tradesConsumers[figi], consumer)
+	if !removed {
+		return xerrors.Errorf("no such consumer subscribed on trades %s", figi)
+	}
+	s.tradesConsumers[figi] = consumers
+
+	if len(consumers) == 0 {
+		delete(s.tradesConsumers, figi)
+
+		unsubscribeRequest := api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeTradesRequest{
+				SubscribeTradesRequest: &api.SubscribeTradesRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_UNSUBSCRIBE,
+					Instruments: []*api.TradeInstrument{
+						{Figi: figi},
+					},
+				},
+			},
+		}
+		if err := s.send(&unsubscribeRequest); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// SubscribeInfo Подписать консьюмера на изменения торгового статуса инструмента
+func (s *SDK) SubscribeInfo(figi string, consumer *TradingStatusConsumer) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	consumers, contains := s.infoConsumers[figi]
+	sub := newSubscriber(consumer, s.logger, func(message *api.MarketDataResponse) {
+		(*consumer).ConsumeTradingStatus(message.GetTradingStatus())
+	})
+	s.infoConsumers[figi] = append(consumers, sub)
 
-	for i, c := range consumers {
-		if c == consumer {
-			s.candlesConsumers[figi] = append(consumers[:i], consumers[i+1:]...)
-			break
+	if !contains {
+		subscribeRequest := api.MarketDataRequest{
+			Payload: &api.MarketDataRequest_SubscribeInfoRequest{
+				SubscribeInfoRequest: &api.SubscribeInfoRequest{
+					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_SUBSCRIBE,
+					Instruments: []*api.InfoInstrument{
+						{Figi: figi},
+					},
+				},
+			},
 		}
+		s.sendSubscribe(&subscribeRequest, figi)
 	}
+	return nil
+}
+
+// UnsubscribeInfo Отписать консьюмера от изменений торгового статуса инструмента
+func (s *SDK) UnsubscribeInfo(figi string, consumer *TradingStatusConsumer) error {
+	s.registryMu.Lock()
+	defer s.registryMu.Unlock()
+
+	consumers, removed := removeSubscriber(s.infoConsumers[figi], consumer)
+	if !removed {
+		return xerrors.Errorf("no such consumer subscribed on trading status %s", figi)
+	}
+	s.infoConsumers[figi] = consumers
 
 	if len(consumers) == 0 {
+		delete(s.infoConsumers, figi)
+
 		unsubscribeRequest := api.MarketDataRequest{
-			Payload: &api.MarketDataRequest_SubscribeCandlesRequest{
-				SubscribeCandlesRequest: &api.SubscribeCandlesRequest{
+			Payload: &api.MarketDataRequest_SubscribeInfoRequest{
+				SubscribeInfoRequest: &api.SubscribeInfoRequest{
 					SubscriptionAction: api.SubscriptionAction_SUBSCRIPTION_ACTION_UNSUBSCRIBE,
-					Instruments: []*api.CandleInstrument{
+					Instruments: []*api.InfoInstrument{
 						{Figi: figi},
 					},
 				},
 			},
 		}
-		err := s.marketDataStreamClient.Send(&unsubscribeRequest)
-		if err != nil {
+		if err := s.send(&unsubscribeRequest); err != nil {
 			return err
 		}
-		delete(s.candlesConsumers, figi)
 	}
 	return nil
 }
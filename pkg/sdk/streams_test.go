@@ -0,0 +1,358 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	api "tinkoff-invest-bot/investapi"
+)
+
+// fakeStream стрим MarketDataStream, который запоминает отправленные запросы
+type fakeStream struct {
+	grpc.ClientStream
+
+	mu       sync.Mutex
+	requests []*api.MarketDataRequest
+	sendErr  error // если не nil, стрим оборван и Send возвращает эту ошибку
+	closed   bool
+}
+
+func (f *fakeStream) Send(request *api.MarketDataRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sendErr != nil {
+		return f.sendErr
+	}
+	f.requests = append(f.requests, request)
+	return nil
+}
+
+func (f *fakeStream) Recv() (*api.MarketDataResponse, error) {
+	select {}
+}
+
+func (f *fakeStream) CloseSend() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeStream) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func (f *fakeStream) breakStream(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sendErr = err
+}
+
+func (f *fakeStream) sent() []*api.MarketDataRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*api.MarketDataRequest(nil), f.requests...)
+}
+
+// fakeStreamService открывает новый fakeStream при каждом переподключении
+type fakeStreamService struct {
+	mu      sync.Mutex
+	streams []*fakeStream
+}
+
+func (f *fakeStreamService) MarketDataStream(context.Context, ...grpc.CallOption) (api.MarketDataStreamService_MarketDataStreamClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stream := &fakeStream{}
+	f.streams = append(f.streams, stream)
+	return stream, nil
+}
+
+func (f *fakeStreamService) last() *fakeStream {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.streams[len(f.streams)-1]
+}
+
+func newTestSDK() (*SDK, *fakeStreamService) {
+	service := &fakeStreamService{}
+	stream, _ := service.MarketDataStream(context.Background())
+	return &SDK{
+		ctx:                    context.Background(),
+		marketDataStream:       service,
+		marketDataStreamClient: stream,
+		candlesConsumers:       make(map[candlesKey][]*subscriber),
+		orderBookConsumers:     make(map[orderBookKey][]*subscriber),
+		tradesConsumers:        make(map[string][]*subscriber),
+		infoConsumers:          make(map[string][]*subscriber),
+		logger:                 zap.NewNop(),
+	}, service
+}
+
+type countingConsumer struct {
+	mu       sync.Mutex
+	messages []*api.MarketDataResponse
+	block    chan struct{} // если не nil, Consume ждёт, пока канал не закроют
+}
+
+func (c *countingConsumer) Consume(data *api.MarketDataResponse) {
+	if c.block != nil {
+		<-c.block
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, data)
+}
+
+func (c *countingConsumer) ConsumeTrade(trade *api.Trade) {
+	c.Consume(&api.MarketDataResponse{Payload: &api.MarketDataResponse_Trade{Trade: trade}})
+}
+
+func (c *countingConsumer) ConsumeTradingStatus(status *api.TradingStatus) {
+	c.Consume(&api.MarketDataResponse{Payload: &api.MarketDataResponse_TradingStatus{TradingStatus: status}})
+}
+
+func (c *countingConsumer) received() []*api.MarketDataResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*api.MarketDataResponse(nil), c.messages...)
+}
+
+func candleMessage(figi string, interval api.SubscriptionInterval, start time.Time, close int64) *api.MarketDataResponse {
+	return &api.MarketDataResponse{Payload: &api.MarketDataResponse_Candle{Candle: &api.Candle{
+		Figi:     figi,
+		Interval: interval,
+		Time:     timestamppb.New(start),
+		Close:    &api.Quotation{Units: close},
+	}}}
+}
+
+func statusMessage(figi string, status api.SecurityTradingStatus) *api.MarketDataResponse {
+	return &api.MarketDataResponse{Payload: &api.MarketDataResponse_TradingStatus{TradingStatus: &api.TradingStatus{
+		Figi:          figi,
+		TradingStatus: status,
+	}}}
+}
+
+func tradeMessage(figi string) *api.MarketDataResponse {
+	return &api.MarketDataResponse{Payload: &api.MarketDataResponse_Trade{Trade: &api.Trade{Figi: figi}}}
+}
+
+// eventually ждёт, пока условие не выполнится, сообщения доставляются консьюмерам асинхронно
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubscriptionsConcurrently(t *testing.T) {
+	s, _ := newTestSDK()
+	interval := api.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_MINUTE
+
+	stop := make(chan struct{})
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() { // стрим присылает сообщения по всем инструментам
+		defer background.Done()
+		start := time.Now().Truncate(time.Minute)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			figi := fmt.Sprintf("FIGI%d", i%8)
+			s.dispatch(candleMessage(figi, interval, start, int64(i)))
+			s.dispatch(tradeMessage(figi))
+			s.dispatch(statusMessage(figi, api.SecurityTradingStatus_SECURITY_TRADING_STATUS_NORMAL_TRADING))
+			time.Sleep(10 * time.Microsecond)
+		}
+	}()
+	go func() { // стрим постоянно переподключается
+		defer background.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := s.reopenStream(); err != nil {
+				t.Errorf("reopen stream: %v", err)
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(figi string) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				var marketData MarketDataConsumer = &countingConsumer{}
+				var trades TradesConsumer = &countingConsumer{}
+				var status TradingStatusConsumer = &countingConsumer{}
+				if err := s.SubscribeCandles(figi, interval, &marketData); err != nil {
+					t.Errorf("subscribe candles: %v", err)
+				}
+				if err := s.SubscribeTrades(figi, &trades); err != nil {
+					t.Errorf("subscribe trades: %v", err)
+				}
+				if err := s.SubscribeInfo(figi, &status); err != nil {
+					t.Errorf("subscribe info: %v", err)
+				}
+				if err := s.UnsubscribeCandles(figi, interval, &marketData); err != nil {
+					t.Errorf("unsubscribe candles: %v", err)
+				}
+				if err := s.UnsubscribeTrades(figi, &trades); err != nil {
+					t.Errorf("unsubscribe trades: %v", err)
+				}
+				if err := s.UnsubscribeInfo(figi, &status); err != nil {
+					t.Errorf("unsubscribe info: %v", err)
+				}
+			}
+		}(fmt.Sprintf("FIGI%d", i))
+	}
+	wg.Wait()
+	close(stop)
+	background.Wait()
+
+	s.registryMu.RLock()
+	defer s.registryMu.RUnlock()
+	if len(s.candlesConsumers) != 0 || len(s.tradesConsumers) != 0 || len(s.infoConsumers) != 0 {
+		t.Fatalf("registry is not empty after all consumers unsubscribed")
+	}
+	if requests := s.activeSubscriptions(); len(requests) != 0 {
+		t.Fatalf("expected no subscriptions to replay, got %d", len(requests))
+	}
+}
+
+func TestReconnectReplaysSubscriptions(t *testing.T) {
+	s, service := newTestSDK()
+	oneMinute := api.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_MINUTE
+	fiveMinutes := api.SubscriptionInterval_SUBSCRIPTION_INTERVAL_FIVE_MINUTES
+
+	var first, second MarketDataConsumer = &countingConsumer{}, &countingConsumer{}
+	var status TradingStatusConsumer = &countingConsumer{}
+	if err := s.SubscribeCandles("FIGI", oneMinute, &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SubscribeCandles("FIGI", fiveMinutes, &second); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SubscribeInfo("FIGI", &status); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.reopenStream(); err != nil {
+		t.Fatal(err)
+	}
+
+	intervals := make(map[api.SubscriptionInterval]bool)
+	var info bool
+	for _, request := range service.last().sent() {
+		for _, instrument := range request.GetSubscribeCandlesRequest().GetInstruments() {
+			intervals[instrument.GetInterval()] = true
+		}
+		info = info || len(request.GetSubscribeInfoRequest().GetInstruments()) > 0
+	}
+	if !intervals[oneMinute] || !intervals[fiveMinutes] || !info {
+		t.Fatalf("subscriptions were not replayed: candles %v, info %v", intervals, info)
+	}
+
+	// каждый консьюмер получает свечи только своего интервала
+	start := time.Now().Truncate(5 * time.Minute)
+	s.dispatch(candleMessage("FIGI", oneMinute, start, 1))
+	s.dispatch(candleMessage("FIGI", fiveMinutes, start, 5))
+	eventually(t, func() bool {
+		return len(first.(*countingConsumer).received()) == 1 && len(second.(*countingConsumer).received()) == 1
+	})
+	if closePrice := first.(*countingConsumer).received()[0].GetCandle().GetClose().GetUnits(); closePrice != 1 {
+		t.Fatalf("one minute consumer received candle with close %d", closePrice)
+	}
+}
+
+func TestSubscribeDuringOutageIsReplayed(t *testing.T) {
+	s, service := newTestSDK()
+	interval := api.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_MINUTE
+	broken := service.last()
+	broken.breakStream(errors.New("stream is broken"))
+
+	var marketData MarketDataConsumer = &countingConsumer{}
+	if err := s.SubscribeCandles("FIGI", interval, &marketData); err != nil {
+		t.Fatalf("subscription during outage failed: %v", err)
+	}
+	if err := s.reopenStream(); err != nil {
+		t.Fatal(err)
+	}
+	if !broken.isClosed() {
+		t.Fatal("old stream was not closed after reconnect")
+	}
+
+	var replayed bool
+	for _, request := range service.last().sent() {
+		for _, instrument := range request.GetSubscribeCandlesRequest().GetInstruments() {
+			replayed = replayed || instrument.GetFigi() == "FIGI" && instrument.GetInterval() == interval
+		}
+	}
+	if !replayed {
+		t.Fatal("subscription made during outage was not replayed after reconnect")
+	}
+}
+
+func TestDispatchKeepsLatestStatusAndCandle(t *testing.T) {
+	s, _ := newTestSDK()
+	interval := api.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_MINUTE
+
+	blocked := &countingConsumer{block: make(chan struct{})}
+	var marketData MarketDataConsumer = blocked
+	var status TradingStatusConsumer = blocked
+	if err := s.SubscribeCandles("FIGI", interval, &marketData); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SubscribeInfo("FIGI", &status); err != nil {
+		t.Fatal(err)
+	}
+
+	// консьюмер занят, а стрим присылает гораздо больше сообщений, чем помещается в очередь
+	start := time.Now().Truncate(time.Minute)
+	for i := 1; i <= 10*consumerQueueSize; i++ {
+		s.dispatch(candleMessage("FIGI", interval, start, int64(i)))
+		s.dispatch(statusMessage("FIGI", api.SecurityTradingStatus_SECURITY_TRADING_STATUS_OPENING_AUCTION_PERIOD))
+	}
+	s.dispatch(statusMessage("FIGI", api.SecurityTradingStatus_SECURITY_TRADING_STATUS_NORMAL_TRADING))
+	s.dispatch(candleMessage("FIGI", interval, start.Add(time.Minute), 1))
+	close(blocked.block)
+
+	var lastCandle *api.Candle
+	var lastStatus *api.TradingStatus
+	eventually(t, func() bool {
+		lastCandle, lastStatus = nil, nil
+		for _, message := range blocked.received() {
+			if message.GetCandle() != nil && message.GetCandle().GetTime().AsTime().Equal(start) {
+				lastCandle = message.GetCandle()
+			}
+			if message.GetTradingStatus() != nil {
+				lastStatus = message.GetTradingStatus()
+			}
+		}
+		return lastStatus.GetTradingStatus() == api.SecurityTradingStatus_SECURITY_TRADING_STATUS_NORMAL_TRADING
+	})
+	if lastCandle.GetClose().GetUnits() != 10*consumerQueueSize {
+		t.Fatalf("final update of the closed candle was lost, last close %d", lastCandle.GetClose().GetUnits())
+	}
+}
@@ -0,0 +1,96 @@
+package sdk
+
+import (
+	"sync"
+	"time"
+
+	api "tinkoff-invest-bot/investapi"
+	"tinkoff-invest-bot/pkg/decimal"
+)
+
+// TradesTape хранит последние обезличенные сделки по инструменту (ленту сделок).
+// Реализует TradesConsumer, поэтому его можно сразу подписать через SubscribeTrades
+type TradesTape struct {
+	mu       sync.RWMutex
+	capacity int
+	trades   []*api.Trade
+}
+
+// NewTradesTape создаёт ленту, которая помнит не больше capacity последних сделок
+func NewTradesTape(capacity int) *TradesTape {
+	return &TradesTape{
+		capacity: capacity,
+		trades:   make([]*api.Trade, 0, capacity),
+	}
+}
+
+// ConsumeTrade добавляет сделку в ленту, самые старые сделки вытесняются
+func (t *TradesTape) ConsumeTrade(trade *api.Trade) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.trades) >= t.capacity {
+		t.trades = t.trades[1:]
+	}
+	t.trades = append(t.trades, trade)
+}
+
+// Trades возвращает копию сделок в ленте, от старых к новым
+func (t *TradesTape) Trades() []*api.Trade {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	trades := make([]*api.Trade, len(t.trades))
+	copy(trades, t.trades)
+	return trades
+}
+
+// LastPrice возвращает цену последней сделки, false если лента пуста
+func (t *TradesTape) LastPrice() (decimal.Decimal, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(t.trades) == 0 {
+		return decimal.Zero, false
+	}
+	return QuotationToDecimal(t.trades[len(t.trades)-1].GetPrice()), true
+}
+
+// VWAP средневзвешенная по объёму цена сделок, совершённых не раньше since
+func (t *TradesTape) VWAP(since time.Time) (decimal.Decimal, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var volume int64
+	var turnover decimal.Decimal
+	for _, trade := range t.trades {
+		if trade.GetTime().AsTime().Before(since) {
+			continue
+		}
+		volume += trade.GetQuantity()
+		turnover = turnover.Add(QuotationToDecimal(trade.GetPrice()).MulInt(trade.GetQuantity()))
+	}
+	if volume == 0 {
+		return decimal.Zero, false
+	}
+	return turnover.DivInt(volume), true
+}
+
+// Volume суммарный объём сделок в лотах, совершённых не раньше since, с разбивкой на покупки и продажи
+func (t *TradesTape) Volume(since time.Time) (buy int64, sell int64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, trade := range t.trades {
+		if trade.GetTime().AsTime().Before(since) {
+			continue
+		}
+		switch trade.GetDirection() {
+		case api.TradeDirection_TRADE_DIRECTION_BUY:
+			buy += trade.GetQuantity()
+		case api.TradeDirection_TRADE_DIRECTION_SELL:
+			sell += trade.GetQuantity()
+		}
+	}
+	return buy, sell
+}
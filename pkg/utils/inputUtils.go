@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
+
+	"tinkoff-invest-bot/pkg/decimal"
 )
 
 // RequestString Запросить у пользователя параметр в виде строки
@@ -85,3 +88,17 @@ func RequestDate(msg string, scanner *bufio.Scanner) time.Time {
 		}
 	}
 }
+
+// RequestDecimal Запросить у пользователя неотрицательное десятичное число
+func RequestDecimal(msg string, scanner *bufio.Scanner) decimal.Decimal {
+	for {
+		input := strings.Replace(RequestString(msg, scanner), ",", ".", 1)
+		if d, err := decimal.NewFromString(input); err != nil {
+			color.Yellow("Ошибка конвертации в число: %v", err)
+		} else if d.Sign() < 0 {
+			color.Yellow("Число не может быть отрицательным")
+		} else {
+			return d
+		}
+	}
+}